@@ -0,0 +1,283 @@
+package extractor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/input"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Action types for Action.Type.
+const (
+	ActionClick   string = "click"
+	ActionScroll  string = "scroll"
+	ActionWaitFor string = "wait_for"
+	ActionWait    string = "wait"
+	ActionType    string = "type"
+	ActionSelect  string = "select"
+	ActionPress   string = "press"
+)
+
+const (
+	// DefaultActionTimeout bounds an action that sets no timeout.
+	DefaultActionTimeout = 10 * time.Second
+	// defaultScrollDelay is the pause after each scroll, giving lazy
+	// content time to load.
+	defaultScrollDelay = time.Second
+)
+
+// Action is a step run on the page in browser mode before the schemas are
+// extracted, e.g. to dismiss a cookie banner or press "load more".
+type Action struct {
+	// Type is click, scroll, wait_for, wait, type, select or press.
+	Type string `json:"type"`
+	// Selector is the element to click, wait for, type into or select in.
+	Selector string `json:"selector,omitempty"`
+	// SelectorType is xpath (the default) or css.
+	SelectorType string `json:"selector_type,omitempty"`
+	// Text is the text to type, the text of the option to select or the key
+	// to press, e.g. Enter, Escape, Tab or a single character.
+	Text string `json:"text,omitempty"`
+	// Times repeats click and scroll actions. Repeated clicks stop without
+	// an error once the element is gone, as "load more" buttons are.
+	Times int `json:"times,omitempty"`
+	// Duration is how long wait actions wait and the pause after each
+	// click or scroll, e.g. "2s".
+	Duration string `json:"duration,omitempty"`
+	// Timeout bounds the action, 10s by default. It does not apply to wait
+	// actions.
+	Timeout string `json:"timeout,omitempty"`
+	// Optional actions may fail without an error being reported, e.g. for
+	// banners that are not always shown.
+	Optional bool `json:"optional,omitempty"`
+}
+
+// actionKeys are the key names press actions accept besides single
+// characters.
+var actionKeys = map[string]input.Key{
+	"Enter":      input.Enter,
+	"Escape":     input.Escape,
+	"Tab":        input.Tab,
+	"Backspace":  input.Backspace,
+	"Delete":     input.Delete,
+	"Space":      input.Space,
+	"ArrowUp":    input.ArrowUp,
+	"ArrowDown":  input.ArrowDown,
+	"ArrowLeft":  input.ArrowLeft,
+	"ArrowRight": input.ArrowRight,
+	"PageUp":     input.PageUp,
+	"PageDown":   input.PageDown,
+	"Home":       input.Home,
+	"End":        input.End,
+}
+
+// actionKey returns the key named by name and whether it is known.
+func actionKey(name string) (key input.Key, ok bool) {
+	if key, ok := actionKeys[name]; ok {
+		return key, true
+	}
+	if len(name) != 1 {
+		return 0, false
+	}
+	defer func() {
+		// rod panics on keys missing from its keyboard layout.
+		if recover() != nil {
+			key, ok = 0, false
+		}
+	}()
+	key = input.Key(name[0])
+	key.Info()
+	return key, true
+}
+
+// runActions runs the actions of the config in order. The errors of actions
+// that are not optional are returned; a failed action does not stop the
+// ones after it.
+func runActions(ctx context.Context, page *rod.Page, actions []Action, url string) []ExtractionError {
+	var actionErrors []ExtractionError
+	for i, action := range actions {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := runAction(page, action); err != nil && !action.Optional {
+			actionErrors = append(actionErrors, ExtractionError{
+				Field:   fmt.Sprintf("actions[%d]", i),
+				Message: fmt.Sprintf("%s action failed: %v", action.Type, err),
+				URL:     url,
+			})
+		}
+	}
+	return actionErrors
+}
+
+// runAction runs action on page. Repeated clicks and scrolls get the
+// timeout for every repetition, and the pauses between them do not count
+// against it.
+func runAction(page *rod.Page, action Action) error {
+	timeout := DefaultActionTimeout
+	if action.Timeout != "" {
+		d, err := time.ParseDuration(action.Timeout)
+		if err != nil {
+			return err
+		}
+		timeout = d
+	}
+	var delay time.Duration
+	if action.Duration != "" {
+		d, err := time.ParseDuration(action.Duration)
+		if err != nil {
+			return err
+		}
+		delay = d
+	}
+
+	switch action.Type {
+	case ActionWait:
+		// Waits are bounded by their duration only.
+		return sleepPage(page, delay)
+
+	case ActionClick:
+		times := action.Times
+		if times < 1 {
+			times = 1
+		}
+		for i := 0; i < times; i++ {
+			gone := false
+			err := withTimeout(page, timeout, func(page *rod.Page) error {
+				el, err := actionElement(page, action, i > 0)
+				if err != nil {
+					return err
+				}
+				if el == nil {
+					gone = true
+					return nil
+				}
+				return el.Click(proto.InputMouseButtonLeft, 1)
+			})
+			if err != nil {
+				return err
+			}
+			if gone {
+				// The element went away after earlier clicks.
+				return nil
+			}
+			if err := sleepPage(page, delay); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case ActionScroll:
+		times := action.Times
+		if times < 1 {
+			times = 1
+		}
+		if action.Duration == "" {
+			delay = defaultScrollDelay
+		}
+		for i := 0; i < times; i++ {
+			err := withTimeout(page, timeout, func(page *rod.Page) error {
+				_, err := page.Eval(`() => window.scrollTo(0, document.body.scrollHeight)`)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if err := sleepPage(page, delay); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return withTimeout(page, timeout, func(page *rod.Page) error {
+		return runStep(page, action)
+	})
+}
+
+// runStep runs the actions that act on the page once.
+func runStep(page *rod.Page, action Action) error {
+	switch action.Type {
+	case ActionWaitFor:
+		el, err := actionElement(page, action, false)
+		if err != nil {
+			return err
+		}
+		return el.WaitVisible()
+
+	case ActionType:
+		el, err := actionElement(page, action, false)
+		if err != nil {
+			return err
+		}
+		return el.Input(action.Text)
+
+	case ActionSelect:
+		el, err := actionElement(page, action, false)
+		if err != nil {
+			return err
+		}
+		return el.Select([]string{action.Text}, true, rod.SelectorTypeText)
+
+	case ActionPress:
+		key, ok := actionKey(action.Text)
+		if !ok {
+			return fmt.Errorf("unknown key %q", action.Text)
+		}
+		if action.Selector != "" {
+			el, err := actionElement(page, action, false)
+			if err != nil {
+				return err
+			}
+			if err := el.Focus(); err != nil {
+				return err
+			}
+		}
+		return page.Keyboard.Type(key)
+	}
+	return fmt.Errorf("unsupported action type %q", action.Type)
+}
+
+// withTimeout calls fn with page bounded by timeout.
+func withTimeout(page *rod.Page, timeout time.Duration, fn func(page *rod.Page) error) error {
+	page = page.Timeout(timeout)
+	defer page.CancelTimeout()
+	return fn(page)
+}
+
+// actionElement finds the element of action, waiting for it to appear
+// until the page times out. With existing set it only checks whether the
+// element is there and returns nil if not.
+func actionElement(page *rod.Page, action Action, existing bool) (*rod.Element, error) {
+	if existing {
+		page = page.Sleeper(rod.NotFoundSleeper)
+	}
+	var el *rod.Element
+	var err error
+	if action.SelectorType == SelectorCSS {
+		el, err = page.Element(action.Selector)
+	} else {
+		el, err = page.ElementX(action.Selector)
+	}
+	var notFound *rod.ElementNotFoundError
+	if existing && errors.As(err, &notFound) {
+		return nil, nil
+	}
+	return el, err
+}
+
+// sleepPage waits for d or until the page context is done.
+func sleepPage(page *rod.Page, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(d):
+		return nil
+	case <-page.GetContext().Done():
+		return page.GetContext().Err()
+	}
+}
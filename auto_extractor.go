@@ -0,0 +1,171 @@
+package extractor
+
+import (
+	"context"
+	"errors"
+	neturl "net/url"
+	"sync"
+)
+
+// AutoExtractor tries the static extractor first and falls back to the
+// browser when the static result looks incomplete, which is typical for pages
+// rendered by JavaScript. The decision is remembered per host so that later
+// pages of a browser-only site go straight to the browser. Configs that rely
+// on the browser, such as those with actions, network captures or js fields,
+// always use it.
+type AutoExtractor struct {
+	Config ExtractorConfig
+
+	static *StaticExtractor
+	pool   *BrowserPool
+
+	mu      sync.Mutex
+	browser *BrowserExtractor
+	modes   map[string]string
+}
+
+func NewAutoExtractor(config ExtractorConfig) *AutoExtractor {
+	return NewAutoExtractorWithPool(config, nil)
+}
+
+// NewAutoExtractorWithPool returns an auto extractor whose browser fallback
+// takes its pages from pool. A nil pool behaves like NewAutoExtractor.
+func NewAutoExtractorWithPool(config ExtractorConfig, pool *BrowserPool) *AutoExtractor {
+	return &AutoExtractor{
+		Config: config,
+		static: NewStaticExtractor(config),
+		pool:   pool,
+		modes:  make(map[string]string),
+	}
+}
+
+// Close shuts down the browser if one was launched for the extractor.
+func (e *AutoExtractor) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.browser == nil {
+		return nil
+	}
+	return e.browser.Close()
+}
+
+func (e *AutoExtractor) ExtractWithoutCache(url string) (*ExtractionResult, error) {
+	return e.extract(context.Background(), url, false)
+}
+
+func (e *AutoExtractor) Extract(url string) (*ExtractionResult, error) {
+	return e.extract(context.Background(), url, true)
+}
+
+func (e *AutoExtractor) ExtractWithoutCacheContext(ctx context.Context, url string) (*ExtractionResult, error) {
+	return e.extract(ctx, url, false)
+}
+
+func (e *AutoExtractor) ExtractContext(ctx context.Context, url string) (*ExtractionResult, error) {
+	return e.extract(ctx, url, true)
+}
+
+// ModeFor returns the mode remembered for the host of url, or an empty
+// string if no decision has been made yet.
+func (e *AutoExtractor) ModeFor(url string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.modes[hostOf(url)]
+}
+
+func (e *AutoExtractor) extract(ctx context.Context, url string, cache bool) (*ExtractionResult, error) {
+	if e.static.compileErr != nil {
+		return nil, e.static.compileErr
+	}
+
+	host := hostOf(url)
+	if !needsBrowser(e.static.compiled) && e.ModeFor(url) != ModeBrowser {
+		result, err := e.static.extract(ctx, url, cache)
+		var timeoutErr *TimeoutError
+		if errors.As(err, &timeoutErr) {
+			return nil, err
+		}
+		if err == nil && isComplete(e.static.compiled, result) {
+			e.setMode(host, ModeStatic)
+			return result, nil
+		}
+	}
+
+	result, err := e.browserExtractor().ExtractContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	// Only pin the host to the browser when it actually helped; an empty
+	// page is empty in both modes.
+	if isComplete(e.static.compiled, result) {
+		e.setMode(host, ModeBrowser)
+	}
+	return result, nil
+}
+
+// browserExtractor launches the browser on first use, so that sites served
+// well by the static extractor never pay for it.
+func (e *AutoExtractor) browserExtractor() *BrowserExtractor {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.browser == nil {
+		e.browser = NewBrowserExtractorWithPool(e.Config, e.pool)
+	}
+	return e.browser
+}
+
+func (e *AutoExtractor) setMode(host, mode string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.modes[host] = mode
+}
+
+// needsBrowser reports whether the config relies on the browser, which the
+// static pass would ignore: it has actions to run on the page, network
+// captures, which fields from the network require, or js fields.
+func needsBrowser(config *CompiledConfig) bool {
+	if len(config.Actions) > 0 || len(config.Network) > 0 {
+		return true
+	}
+	for _, schema := range config.Schemas {
+		if hasJSField(schema.Fields) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasJSField reports whether any of fields or their sub-fields is a js
+// field.
+func hasJSField(fields []Field) bool {
+	for _, field := range fields {
+		if field.Type == FieldJS || hasJSField(field.Fields) {
+			return true
+		}
+	}
+	return false
+}
+
+// isComplete reports whether the result is good enough to skip the browser:
+// the page did not fail, every schema produced at least one item and no item
+// was dropped for breaking the schema rules.
+func isComplete(config *CompiledConfig, result *ExtractionResult) bool {
+	if result.Status == StatusFailed {
+		return false
+	}
+	for _, schema := range config.Schemas {
+		schemaResult := result.SchemaResults[schema.Name]
+		if len(schemaResult.Items) == 0 || schemaResult.Dropped > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func hostOf(url string) string {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return url
+	}
+	return u.Host
+}
@@ -0,0 +1,358 @@
+package extractor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// DefaultMaxPages is the number of pages a BrowserPool has open at the same
+// time unless BrowserPoolOptions.MaxPages is set.
+const DefaultMaxPages = 4
+
+// healthCheckTimeout bounds the check whether a browser still responds
+// before a page is opened in it.
+const healthCheckTimeout = 5 * time.Second
+
+// ErrPoolClosed is returned for pages requested from a closed BrowserPool.
+var ErrPoolClosed = errors.New("browser pool is closed")
+
+type BrowserPoolOptions struct {
+	// Browsers is the number of browsers launched, 1 by default. Pages are
+	// spread over them.
+	Browsers int
+	// MaxPages limits the pages open at the same time; further requests
+	// wait for a page to be released.
+	MaxPages int
+	// Incognito opens every page in its own browser context, so that pages
+	// share no cookies, storage or cache.
+	Incognito bool
+}
+
+// BrowserPool owns the browsers used for extraction and hands out their
+// pages. Browsers are launched on first use and relaunched when they stop
+// responding, and tabs that were not closed properly are closed before new
+// pages are opened. A pool is safe for concurrent use and can be shared by
+// several extractors.
+type BrowserPool struct {
+	opts  BrowserPoolOptions
+	slots chan struct{}
+	// turns holds one token per browser. Launching, checking and opening
+	// pages in a browser take its token, so that these slow steps run
+	// without mu and only wait for each other within the same browser.
+	turns []chan struct{}
+
+	mu       sync.Mutex
+	browsers []*pooledBrowser
+	// opening counts the pages being opened in each browser.
+	opening []int
+	closed  bool
+}
+
+type pooledBrowser struct {
+	browser  *rod.Browser
+	launcher *launcher.Launcher
+	// pages maps the pages handed out and not yet released to their
+	// browser context, the default one outside incognito mode.
+	pages map[proto.TargetTargetID]proto.BrowserBrowserContextID
+	// defaultContext is the ID of the default browser context, resolved
+	// when the first page outside incognito mode is opened.
+	defaultContext proto.BrowserBrowserContextID
+}
+
+func NewBrowserPool(opts BrowserPoolOptions) *BrowserPool {
+	if opts.Browsers < 1 {
+		opts.Browsers = 1
+	}
+	if opts.MaxPages < 1 {
+		opts.MaxPages = DefaultMaxPages
+	}
+	turns := make([]chan struct{}, opts.Browsers)
+	for i := range turns {
+		turns[i] = make(chan struct{}, 1)
+	}
+	return &BrowserPool{
+		opts:     opts,
+		slots:    make(chan struct{}, opts.MaxPages),
+		turns:    turns,
+		browsers: make([]*pooledBrowser, opts.Browsers),
+		opening:  make([]int, opts.Browsers),
+	}
+}
+
+// Page waits for a free slot and opens a blank page. ctx bounds the wait
+// for the slot and for the browser, which pages are opened in one at a time.
+// The returned release function closes the page and frees the slot; it must
+// be called once the page is no longer needed, also when ctx was cancelled.
+func (p *BrowserPool) Page(ctx context.Context) (page *rod.Page, release func(), err error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			page, release, err = nil, nil, fmt.Errorf("browser panicked: %v", r)
+		}
+		if err != nil {
+			<-p.slots
+		}
+	}()
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, nil, ErrPoolClosed
+	}
+	i := p.leastBusy()
+	p.opening[i]++
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.opening[i]--
+		p.mu.Unlock()
+	}()
+
+	select {
+	case p.turns[i] <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	defer func() { <-p.turns[i] }()
+
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		b, err := p.browser(i)
+		if err != nil {
+			return nil, nil, err
+		}
+		page, browserContext, err := b.open(p.opts.Incognito)
+		if err == nil {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.closed {
+				return nil, nil, ErrPoolClosed
+			}
+			b.pages[page.TargetID] = browserContext
+			var once sync.Once
+			return page, func() { once.Do(func() { p.release(b, page) }) }, nil
+		}
+		if attempt > 0 {
+			return nil, nil, fmt.Errorf("failed to create page: %v", err)
+		}
+		// The browser may have crashed since it was checked; relaunch it
+		// and try once more.
+		p.discard(i, b)
+	}
+}
+
+// Close shuts down the browsers of the pool. Pages that are still in use
+// stop working and later calls of Page fail with ErrPoolClosed.
+func (p *BrowserPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	browsers := p.browsers
+	p.browsers = make([]*pooledBrowser, len(browsers))
+	p.mu.Unlock()
+
+	for _, b := range browsers {
+		if b != nil {
+			b.close()
+		}
+	}
+	return nil
+}
+
+func (p *BrowserPool) release(b *pooledBrowser, page *rod.Page) {
+	// Close through the browser rather than the page, whose context may
+	// have been cancelled.
+	_, _ = proto.TargetCloseTarget{TargetID: page.TargetID}.Call(b.browser)
+
+	p.mu.Lock()
+	browserContext := b.pages[page.TargetID]
+	delete(b.pages, page.TargetID)
+	p.mu.Unlock()
+
+	if p.opts.Incognito {
+		// Disposing the context also closes popups the page opened.
+		_ = proto.TargetDisposeBrowserContext{BrowserContextID: browserContext}.Call(b.browser)
+	}
+	<-p.slots
+}
+
+// leastBusy returns the index of the browser with the fewest open pages,
+// including those being opened, counting browsers that are not running yet
+// as idle. p.mu must be held.
+func (p *BrowserPool) leastBusy() int {
+	best, fewest := 0, -1
+	for i, b := range p.browsers {
+		n := p.opening[i]
+		if b != nil {
+			n += len(b.pages)
+		}
+		if fewest == -1 || n < fewest {
+			best, fewest = i, n
+		}
+	}
+	return best
+}
+
+// browser returns the browser at index i, launching it if it is not running
+// and relaunching it if it no longer responds. The caller holds the turn of
+// the browser.
+func (p *BrowserPool) browser(i int) (*pooledBrowser, error) {
+	p.mu.Lock()
+	b := p.browsers[i]
+	p.mu.Unlock()
+	if b != nil {
+		if b.alive() {
+			b.sweep(p.inUse(b))
+			return b, nil
+		}
+		p.discard(i, b)
+	}
+
+	b, err := launchBrowser()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		b.close()
+		return nil, ErrPoolClosed
+	}
+	p.browsers[i] = b
+	return b, nil
+}
+
+// discard removes the browser b at index i from the pool and shuts it down.
+func (p *BrowserPool) discard(i int, b *pooledBrowser) {
+	p.mu.Lock()
+	if p.browsers[i] == b {
+		p.browsers[i] = nil
+	}
+	p.mu.Unlock()
+	b.close()
+}
+
+// inUse returns the pages of b that are handed out and their browser
+// contexts.
+func (p *BrowserPool) inUse(b *pooledBrowser) map[proto.TargetTargetID]proto.BrowserBrowserContextID {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pages := make(map[proto.TargetTargetID]proto.BrowserBrowserContextID, len(b.pages))
+	for id, browserContext := range b.pages {
+		pages[id] = browserContext
+	}
+	return pages
+}
+
+func launchBrowser() (*pooledBrowser, error) {
+	l := launcher.New().Set("--no-sandbox")
+	controlURL, err := l.Launch()
+	if err != nil {
+		return nil, fmt.Errorf("failed to launch browser: %v", err)
+	}
+	b := &pooledBrowser{
+		browser:  rod.New().ControlURL(controlURL),
+		launcher: l,
+		pages:    make(map[proto.TargetTargetID]proto.BrowserBrowserContextID),
+	}
+	if err := b.browser.Connect(); err != nil {
+		l.Kill()
+		l.Cleanup()
+		return nil, fmt.Errorf("failed to connect to browser: %v", err)
+	}
+	return b, nil
+}
+
+func (b *pooledBrowser) alive() bool {
+	browser := b.browser.Timeout(healthCheckTimeout)
+	defer browser.CancelTimeout()
+	_, err := browser.Version()
+	return err == nil
+}
+
+// open creates a blank page, in a new browser context when incognito is set
+// and in the default one otherwise, and returns it with its browser context.
+// The caller holds the turn of the browser.
+func (b *pooledBrowser) open(incognito bool) (*rod.Page, proto.BrowserBrowserContextID, error) {
+	browser := b.browser
+	if incognito {
+		var err error
+		if browser, err = browser.Incognito(); err != nil {
+			return nil, "", err
+		}
+	}
+	page, err := browser.Page(proto.TargetCreateTarget{})
+	if err != nil {
+		if incognito {
+			_ = browser.Close()
+		}
+		return nil, "", err
+	}
+	if incognito {
+		return page, browser.BrowserContextID, nil
+	}
+	if b.defaultContext == "" {
+		// Targets report the real ID of the default context, which sweep
+		// must recognise to keep the popups of pages in use.
+		info, err := proto.TargetGetTargetInfo{TargetID: page.TargetID}.Call(b.browser)
+		if err != nil {
+			_, _ = proto.TargetCloseTarget{TargetID: page.TargetID}.Call(b.browser)
+			return nil, "", err
+		}
+		b.defaultContext = info.TargetInfo.BrowserContextID
+	}
+	return page, b.defaultContext, nil
+}
+
+// sweep closes the tabs and browser contexts that are not among pages, the
+// ones handed out, such as tabs whose closing failed, crashed tabs and
+// popups. Tabs in the browser context of a page in use are kept, since they
+// may be its popups; outside incognito mode that is every tab while any page
+// is in use.
+func (b *pooledBrowser) sweep(pages map[proto.TargetTargetID]proto.BrowserBrowserContextID) {
+	inUse := make(map[proto.BrowserBrowserContextID]bool)
+	for _, browserContext := range pages {
+		inUse[browserContext] = true
+	}
+	if targets, err := (proto.TargetGetTargets{}).Call(b.browser); err == nil {
+		for _, target := range targets.TargetInfos {
+			if target.Type != proto.TargetTargetInfoTypePage {
+				continue
+			}
+			if _, ok := pages[target.TargetID]; !ok && !inUse[target.BrowserContextID] {
+				_, _ = proto.TargetCloseTarget{TargetID: target.TargetID}.Call(b.browser)
+			}
+		}
+	}
+	if contexts, err := (proto.TargetGetBrowserContexts{}).Call(b.browser); err == nil {
+		for _, browserContext := range contexts.BrowserContextIDs {
+			if !inUse[browserContext] {
+				_ = proto.TargetDisposeBrowserContext{BrowserContextID: browserContext}.Call(b.browser)
+			}
+		}
+	}
+}
+
+// close shuts the browser down. The process is killed as well, in case it
+// no longer responds.
+func (b *pooledBrowser) close() {
+	_ = b.browser.Close()
+	b.launcher.Kill()
+	b.launcher.Cleanup()
+}
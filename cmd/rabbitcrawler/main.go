@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -18,7 +19,10 @@ var (
 	urlFile    = flag.String("urls", "", "File containing URLs to process, one per line")
 	workers    = flag.Int("workers", 2, "Number of concurrent workers")
 	outputFile = flag.String("output", "output.json", "Path to output JSON file")
-	mode       = flag.String("mode", "auto", "Mode: auto, browser or static")
+	mode       = flag.String("mode", "auto", "Mode: auto, browser, static, json or xml")
+	timeout    = flag.Duration("timeout", 0, "Maximum time to spend on each URL (0 means no limit)")
+	browsers   = flag.Int("browsers", 1, "Number of browsers shared by the workers")
+	incognito  = flag.Bool("incognito", false, "Open every page in its own browser context")
 )
 
 type Result struct {
@@ -52,9 +56,22 @@ func main() {
 
 	urlChan := make(chan string, *workers)
 
+	// All workers share the browsers, which are only launched if a worker
+	// needs one.
+	pool := extractor.NewBrowserPool(extractor.BrowserPoolOptions{
+		Browsers:  *browsers,
+		MaxPages:  *workers,
+		Incognito: *incognito,
+	})
+	defer pool.Close()
+
+	// The workers share one extractor, so that what auto mode learns about
+	// a host applies to the whole crawl.
+	e := newExtractor(config, pool)
+
 	for i := 0; i < *workers; i++ {
 		wg.Add(1)
-		go worker(config, urlChan, results, &wg)
+		go worker(e, urlChan, results, &wg)
 	}
 
 	done := make(chan bool)
@@ -82,6 +99,11 @@ func loadConfig(path string) (extractor.ExtractorConfig, error) {
 	if err := json.Unmarshal(data, &config); err != nil {
 		return config, fmt.Errorf("parsing config JSON: %w", err)
 	}
+
+	config = applyMode(config)
+	if _, err := extractor.CompileConfig(config); err != nil {
+		return config, fmt.Errorf("validating config: %w", err)
+	}
 	return config, nil
 }
 
@@ -107,21 +129,46 @@ func loadURLs(path string) ([]string, error) {
 	return urls, nil
 }
 
-func worker(config extractor.ExtractorConfig, urls <-chan string, results chan<- Result, wg *sync.WaitGroup) {
-	defer wg.Done()
+func newExtractor(config extractor.ExtractorConfig, pool *extractor.BrowserPool) extractor.Extractor {
+	switch *mode {
+	case "static":
+		return extractor.NewStaticExtractor(config)
+	case "browser":
+		return extractor.NewBrowserExtractorWithPool(config, pool)
+	case "json":
+		return extractor.NewJSONExtractor(config)
+	case "xml":
+		return extractor.NewXMLExtractor(config)
+	}
+	return extractor.NewExtractorWithPool(config, pool)
+}
 
-	var e extractor.Extractor
+// applyMode sets the mode of config from the -mode flag, so that the config
+// is validated and extracted in the mode it runs in. In auto mode the config
+// or its preset picks the mode, with auto detection otherwise.
+func applyMode(config extractor.ExtractorConfig) extractor.ExtractorConfig {
 	switch *mode {
 	case "static":
-		e = extractor.NewStaticExtractor(config)
+		config.Mode = extractor.ModeStatic
 	case "browser":
-		e = extractor.NewBrowserExtractor(config)
+		config.Mode = extractor.ModeBrowser
+	case "json":
+		config.Mode = extractor.ModeJSON
+	case "xml":
+		config.Mode = extractor.ModeXML
 	default:
-		e = extractor.NewExtractor(config)
+		if config.Mode == "" && config.Preset == "" {
+			config.Mode = extractor.ModeAuto
+		}
 	}
+	return config
+}
+
+func worker(e extractor.Extractor, urls <-chan string, results chan<- Result, wg *sync.WaitGroup) {
+	defer wg.Done()
 
 	for url := range urls {
-		result, err := e.Extract(url)
+		result, err := extract(e, url)
 		if err != nil {
 			results <- Result{
 				URL:   url,
@@ -137,6 +184,16 @@ func worker(config extractor.ExtractorConfig, urls <-chan string, results chan<-
 	}
 }
 
+func extract(e extractor.Extractor, url string) (*extractor.ExtractionResult, error) {
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	return e.ExtractContext(ctx, url)
+}
+
 func collectResults(results <-chan Result, done chan<- bool, bar *pb.ProgressBar) {
 	file, err := os.OpenFile(*outputFile, os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
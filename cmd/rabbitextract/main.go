@@ -1,38 +1,72 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"sort"
 
 	"github.com/crawlerclub/extractor"
 	"zliu.org/goutil"
 )
 
 var (
-	configFile = flag.String("config", "", "Path to the config JSON file")
-	url        = flag.String("url", "", "URL to extract data from")
-	mode       = flag.String("mode", "auto", "Mode: auto, browser or static")
-	outputFile = flag.String("output", "", "Output file path (optional, defaults to stdout)")
+	configFile  = flag.String("config", "", "Path to the config JSON file")
+	url         = flag.String("url", "", "URL to extract data from")
+	inputFile   = flag.String("file", "", "Read HTML from this file instead of fetching the URL (- for stdin)")
+	mode        = flag.String("mode", "auto", "Mode: auto, browser, static, json or xml")
+	preset      = flag.String("preset", "", "Built-in config to use, e.g. feed for RSS and Atom feeds")
+	outputFile  = flag.String("output", "", "Output file path (optional, defaults to stdout)")
+	printSchema = flag.Bool("schema", false, "Print the JSON Schema of the items the config produces and exit")
+	timeout     = flag.Duration("timeout", 0, "Maximum time to spend on the URL, e.g. 30s (0 means no limit)")
+	debug       = flag.Bool("debug", false, "Log which selector of each fallback chain matched and how many requests were blocked")
 )
 
 func main() {
 	flag.Parse()
 
-	if *configFile == "" {
-		log.Fatal("config file is required")
+	if *configFile == "" && *preset == "" {
+		log.Fatal("config file or preset is required")
 	}
 
-	configData, err := os.ReadFile(*configFile)
-	if err != nil {
-		log.Fatalf("Error reading config file: %v", err)
+	var config extractor.ExtractorConfig
+	if *configFile != "" {
+		configData, err := os.ReadFile(*configFile)
+		if err != nil {
+			log.Fatalf("Error reading config file: %v", err)
+		}
+		if err := json.Unmarshal(configData, &config); err != nil {
+			log.Fatalf("Error parsing config JSON: %v", err)
+		}
+	}
+	if *preset != "" {
+		config.Preset = *preset
 	}
+	config = applyMode(config)
 
-	var config extractor.ExtractorConfig
-	if err := json.Unmarshal(configData, &config); err != nil {
-		log.Fatalf("Error parsing config JSON: %v", err)
+	if _, err := extractor.CompileConfig(config); err != nil {
+		var configErr *extractor.ConfigError
+		if errors.As(err, &configErr) {
+			for _, problem := range configErr.Problems {
+				log.Printf("Config problem at %s", problem)
+			}
+			log.Fatalf("Config has %d problem(s)", len(configErr.Problems))
+		}
+		log.Fatalf("Error validating config: %v", err)
+	}
+
+	if *printSchema {
+		schemaData, err := json.MarshalIndent(extractor.JSONSchema(config), "", "  ")
+		if err != nil {
+			log.Fatalf("Error converting JSON Schema to JSON: %v", err)
+		}
+		fmt.Println(string(schemaData))
+		return
 	}
 
 	if *url == "" {
@@ -42,21 +76,44 @@ func main() {
 		log.Fatal("url is required and must be provided via flag or in the config")
 	}
 
-	var worker extractor.Extractor
-	switch *mode {
-	case "static":
-		worker = extractor.NewStaticExtractor(config)
-	case "browser":
-		worker = extractor.NewBrowserExtractor(config)
-	default:
-		worker = extractor.NewExtractor(config)
+	var result *extractor.ExtractionResult
+	var err error
+	if *inputFile != "" {
+		result, err = extractFile(config, *inputFile, *url)
+	} else {
+		var worker extractor.Extractor
+		switch *mode {
+		case "static":
+			worker = extractor.NewStaticExtractor(config)
+		case "browser":
+			worker = extractor.NewBrowserExtractor(config)
+		case "json":
+			worker = extractor.NewJSONExtractor(config)
+		case "xml":
+			worker = extractor.NewXMLExtractor(config)
+		default:
+			worker = extractor.NewExtractor(config)
+		}
+
+		ctx := context.Background()
+		if *timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
+		}
+		result, err = worker.ExtractContext(ctx, *url)
+		// Shut down the browser, if one was launched.
+		if closer, ok := worker.(io.Closer); ok {
+			closer.Close()
+		}
 	}
-	result, err := worker.Extract(*url)
 
 	if err != nil {
 		log.Fatalf("Error extracting data: %v", err)
 	}
 
+	log.Printf("Extracted %s in %s mode: %s", result.FinalURL, result.Mode, result.Status)
+
 	if len(result.Errors) > 0 {
 		log.Println("Extraction completed with errors:")
 		for _, err := range result.Errors {
@@ -64,6 +121,20 @@ func main() {
 		}
 	}
 
+	if *debug {
+		paths := make([]string, 0, len(result.Debug.SelectorHits))
+		for path := range result.Debug.SelectorHits {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			log.Printf("Selector hits for %s: %v", path, result.Debug.SelectorHits[path])
+		}
+		if len(result.Debug.BlockedRequests) > 0 {
+			log.Printf("Blocked requests: %v", result.Debug.BlockedRequests)
+		}
+	}
+
 	jsonData, err := goutil.JSONMarshal(result.SchemaResults)
 	if err != nil {
 		log.Fatalf("Error converting results to JSON: %v", err)
@@ -78,3 +149,49 @@ func main() {
 		fmt.Println(string(jsonData))
 	}
 }
+
+// applyMode sets the mode of config from the -mode flag, so that the config
+// is validated and extracted in the mode it runs in. In auto mode the config
+// or its preset picks the mode, with auto detection otherwise.
+func applyMode(config extractor.ExtractorConfig) extractor.ExtractorConfig {
+	switch *mode {
+	case "static":
+		config.Mode = extractor.ModeStatic
+	case "browser":
+		config.Mode = extractor.ModeBrowser
+	case "json":
+		config.Mode = extractor.ModeJSON
+	case "xml":
+		config.Mode = extractor.ModeXML
+	default:
+		if config.Mode == "" && config.Preset == "" {
+			config.Mode = extractor.ModeAuto
+		}
+	}
+	return config
+}
+
+// extractFile runs the config against a local HTML file, or a JSON or XML
+// file in json and xml mode, or stdin when path is "-". pageURL is used as
+// the logical URL of the page.
+func extractFile(config extractor.ExtractorConfig, path, pageURL string) (*extractor.ExtractionResult, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("opening input file: %w", err)
+		}
+		defer file.Close()
+		r = file
+	}
+	if config.Mode == extractor.ModeJSON {
+		return extractor.NewJSONExtractor(config).ExtractReader(r, pageURL)
+	}
+	if config.Mode == extractor.ModeXML || config.Preset != "" {
+		return extractor.NewXMLExtractor(config).ExtractReader(r, pageURL)
+	}
+	if *mode == "browser" {
+		log.Println("Browser mode is not available for local files, using static mode")
+	}
+	return extractor.NewStaticExtractor(config).ExtractReader(r, pageURL)
+}
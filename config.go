@@ -0,0 +1,678 @@
+package extractor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/antchfx/xpath"
+)
+
+// CompiledConfig is an ExtractorConfig that has been validated, with its
+// regular expressions and selectors compiled ahead of extraction. Selector
+// types are resolved, so every schema and field has an explicit one.
+type CompiledConfig struct {
+	ExtractorConfig
+
+	patterns     map[string]*regexp.Regexp
+	xpaths       map[string]*xpath.Expr
+	cssSelectors map[string]cssSelector
+	jsonPaths    map[string]*jsonPath
+	// namespaces are the prefixes XPath selectors may use in xml mode.
+	namespaces map[string]string
+}
+
+// ConfigProblem is a single problem found in a config. Path points at the
+// offending value, e.g. schemas[0].fields[3].pattern.
+type ConfigProblem struct {
+	Path    string
+	Message string
+}
+
+func (p ConfigProblem) String() string {
+	return fmt.Sprintf("%s: %s", p.Path, p.Message)
+}
+
+// ConfigError is returned by CompileConfig and lists every problem found.
+type ConfigError struct {
+	Problems []ConfigProblem
+}
+
+func (e *ConfigError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.String()
+	}
+	return fmt.Sprintf("invalid config: %s", strings.Join(msgs, "; "))
+}
+
+// CompileConfig validates every schema and field of config recursively and
+// compiles its patterns and selectors. All problems are reported at once in
+// a *ConfigError.
+func CompileConfig(config ExtractorConfig) (*CompiledConfig, error) {
+	config = applyPreset(config)
+	defaultSelectorType := SelectorXPath
+	if config.Mode == ModeJSON {
+		defaultSelectorType = SelectorJSONPath
+	}
+	config.Schemas = append([]Schema(nil), config.Schemas...)
+	for i := range config.Schemas {
+		if config.Schemas[i].SelectorType == "" {
+			config.Schemas[i].SelectorType = defaultSelectorType
+		}
+		config.Schemas[i].Fields = inheritSelectorType(config.Schemas[i].Fields, config.Schemas[i].SelectorType)
+	}
+	c := &configCompiler{
+		compiled: &CompiledConfig{
+			ExtractorConfig: config,
+			patterns:        make(map[string]*regexp.Regexp),
+			xpaths:          make(map[string]*xpath.Expr),
+			cssSelectors:    make(map[string]cssSelector),
+			jsonPaths:       make(map[string]*jsonPath),
+		},
+	}
+	if config.Mode == ModeXML {
+		c.compiled.namespaces = make(map[string]string)
+		for prefix, uri := range defaultNamespaces {
+			c.compiled.namespaces[prefix] = uri
+		}
+		for prefix, uri := range config.Namespaces {
+			c.compiled.namespaces[prefix] = uri
+		}
+	}
+	c.compileConfig(config)
+	if len(c.problems) > 0 {
+		return nil, &ConfigError{Problems: c.problems}
+	}
+	return c.compiled, nil
+}
+
+// regexp returns the compiled form of pattern, compiling it on demand for
+// patterns that were not part of the config.
+func (c *CompiledConfig) regexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := c.patterns[pattern]; ok {
+		return re, nil
+	}
+	return regexp.Compile(pattern)
+}
+
+// xpath returns the compiled form of an XPath selector, compiling it on
+// demand for selectors that were not part of the config.
+func (c *CompiledConfig) xpath(selector string) (*xpath.Expr, error) {
+	if expr, ok := c.xpaths[selector]; ok {
+		return expr, nil
+	}
+	return c.newXPath(selector)
+}
+
+// newXPath compiles an XPath selector, resolving prefixes in xml mode.
+func (c *CompiledConfig) newXPath(selector string) (*xpath.Expr, error) {
+	if c.Mode == ModeXML {
+		return xpath.CompileWithNS(selector, c.namespaces)
+	}
+	return xpath.Compile(selector)
+}
+
+// css returns the compiled form of a CSS selector, compiling it on demand
+// for selectors that were not part of the config.
+func (c *CompiledConfig) css(selector string) (cssSelector, error) {
+	if sel, ok := c.cssSelectors[selector]; ok {
+		return sel, nil
+	}
+	return compileCSS(selector)
+}
+
+// jsonPath returns the compiled form of a JSONPath expression, compiling it
+// on demand for expressions that were not part of the config.
+func (c *CompiledConfig) jsonPath(expr string) (*jsonPath, error) {
+	if path, ok := c.jsonPaths[expr]; ok {
+		return path, nil
+	}
+	return compileJSONPath(expr)
+}
+
+// inheritSelectorType returns a copy of fields in which fields without a
+// selector type get selectorType, recursively.
+func inheritSelectorType(fields []Field, selectorType string) []Field {
+	if fields == nil {
+		return nil
+	}
+	result := make([]Field, len(fields))
+	for i, field := range fields {
+		if field.SelectorType == "" {
+			field.SelectorType = selectorType
+		}
+		field.Fields = inheritSelectorType(field.Fields, field.SelectorType)
+		result[i] = field
+	}
+	return result
+}
+
+type configCompiler struct {
+	compiled *CompiledConfig
+	problems []ConfigProblem
+}
+
+func (c *configCompiler) addProblem(path, format string, args ...interface{}) {
+	c.problems = append(c.problems, ConfigProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *configCompiler) compilePattern(path, pattern string) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		c.addProblem(path, "invalid regular expression: %v", err)
+		return
+	}
+	c.compiled.patterns[pattern] = re
+}
+
+// compileSelector checks selector according to its type.
+func (c *configCompiler) compileSelector(path, selectorType, selector string) {
+	switch selectorType {
+	case SelectorXPath:
+		c.compileXPath(path, selector)
+	case SelectorCSS:
+		c.compileCSS(path, selector)
+	case SelectorJSONPath:
+		if selector == "" {
+			c.addProblem(path, "selector is required")
+			return
+		}
+		c.compileJSONPath(path, selector)
+	}
+}
+
+func (c *configCompiler) compileCSS(path, selector string) {
+	if selector == "" {
+		c.addProblem(path, "selector is required")
+		return
+	}
+	sel, err := compileCSS(selector)
+	if err != nil {
+		c.addProblem(path, "%v", err)
+		return
+	}
+	c.compiled.cssSelectors[selector] = sel
+}
+
+func (c *configCompiler) compileJSONPath(path, expr string) {
+	compiled, err := compileJSONPath(expr)
+	if err != nil {
+		c.addProblem(path, "%v", err)
+		return
+	}
+	c.compiled.jsonPaths[expr] = compiled
+}
+
+func (c *configCompiler) compileXPath(path, selector string) {
+	if selector == "" {
+		c.addProblem(path, "selector is required")
+		return
+	}
+	if !isValidXPath(selector) {
+		c.addProblem(path, "unbalanced parentheses in XPath expression")
+		return
+	}
+	if strings.Contains(selector, "count(") {
+		// count(...) is substituted with a number at extraction time, so
+		// only the inner expressions and the substituted form can be checked.
+		substituted, inner := splitCountExpressions(selector)
+		for _, expr := range inner {
+			if _, err := c.compiled.newXPath(expr); err != nil {
+				c.addProblem(path, "invalid XPath expression in count(%s): %v", expr, err)
+			}
+		}
+		if _, err := c.compiled.newXPath(substituted); err != nil {
+			c.addProblem(path, "invalid XPath expression: %v", err)
+		}
+		return
+	}
+	expr, err := c.compiled.newXPath(selector)
+	if err != nil {
+		c.addProblem(path, "invalid XPath expression: %v", err)
+		return
+	}
+	c.compiled.xpaths[selector] = expr
+}
+
+func (c *configCompiler) compileConfig(config ExtractorConfig) {
+	switch config.Mode {
+	case "", ModeStatic, ModeBrowser, ModeAuto, ModeJSON, ModeXML:
+	default:
+		c.addProblem("mode", "unsupported mode %q", config.Mode)
+	}
+	switch config.Preset {
+	case "":
+	case PresetFeed:
+		if config.Mode != ModeXML {
+			c.addProblem("preset", "preset %q requires %s mode", config.Preset, ModeXML)
+		}
+	default:
+		c.addProblem("preset", "unsupported preset %q", config.Preset)
+	}
+	c.compileActions(config.Actions)
+	c.compileNetwork(config.Network)
+	if config.Block != nil {
+		c.compileBlock(*config.Block)
+	}
+	for prefix, uri := range config.Namespaces {
+		if prefix == "" || uri == "" {
+			c.addProblem("namespaces", "namespace prefixes and URIs must not be empty")
+			break
+		}
+	}
+	if config.Pattern != "" {
+		c.compilePattern("pattern", config.Pattern)
+	}
+	if len(config.Schemas) == 0 {
+		c.addProblem("schemas", "at least one schema is required")
+	}
+
+	names := make(map[string]bool)
+	for i, schema := range config.Schemas {
+		path := fmt.Sprintf("schemas[%d]", i)
+		if schema.Name == "" {
+			c.addProblem(path+".name", "name is required")
+		} else if names[schema.Name] {
+			c.addProblem(path+".name", "duplicate schema name %q", schema.Name)
+		}
+		names[schema.Name] = true
+		c.compileSelectorType(path, schema.SelectorType)
+		c.compileSelector(path+".selector", schema.SelectorType, schema.Selector)
+		if len(schema.Fields) == 0 {
+			c.addProblem(path+".fields", "at least one field is required")
+		}
+		c.compileFields(path, schema.Fields)
+		if schema.MinItems < 0 {
+			c.addProblem(path+".min_items", "min_items must not be negative")
+		}
+		for j, name := range schema.RequiredFields {
+			if !hasField(schema.Fields, name) {
+				c.addProblem(fmt.Sprintf("%s.required_fields[%d]", path, j), "unknown field %q", name)
+			}
+		}
+		if schema.ID != nil {
+			c.compileIDConfig(path+".id", *schema.ID)
+		}
+	}
+}
+
+func (c *configCompiler) compileActions(actions []Action) {
+	for i, action := range actions {
+		path := fmt.Sprintf("actions[%d]", i)
+		needsSelector, needsText := false, false
+		switch action.Type {
+		case ActionClick, ActionWaitFor:
+			needsSelector = true
+		case ActionType, ActionSelect:
+			needsSelector, needsText = true, true
+		case ActionPress:
+			needsText = true
+			if _, ok := actionKey(action.Text); action.Text != "" && !ok {
+				c.addProblem(path+".text", "unknown key %q", action.Text)
+			}
+		case ActionScroll:
+		case ActionWait:
+			if action.Duration == "" {
+				c.addProblem(path+".duration", "duration is required for %s actions", action.Type)
+			}
+		case "":
+			c.addProblem(path+".type", "type is required")
+		default:
+			c.addProblem(path+".type", "unsupported action type %q", action.Type)
+		}
+
+		selectorType := action.SelectorType
+		if selectorType == "" {
+			selectorType = SelectorXPath
+		}
+		switch selectorType {
+		case SelectorXPath, SelectorCSS:
+		default:
+			c.addProblem(path+".selector_type", "unsupported selector type %q", selectorType)
+		}
+		if needsSelector || action.Selector != "" {
+			c.compileSelector(path+".selector", selectorType, action.Selector)
+		}
+		if needsText && action.Text == "" {
+			c.addProblem(path+".text", "text is required for %s actions", action.Type)
+		}
+		if action.Times < 0 {
+			c.addProblem(path+".times", "times must not be negative")
+		}
+		if action.Duration != "" {
+			c.compileDuration(path+".duration", action.Duration)
+		}
+		if action.Timeout != "" {
+			c.compileDuration(path+".timeout", action.Timeout)
+		}
+	}
+}
+
+func (c *configCompiler) compileNetwork(captures []NetworkCapture) {
+	names := make(map[string]bool)
+	for i, capture := range captures {
+		path := fmt.Sprintf("network[%d]", i)
+		if capture.Name == "" {
+			c.addProblem(path+".name", "name is required")
+		} else if names[capture.Name] {
+			c.addProblem(path+".name", "duplicate capture name %q", capture.Name)
+		}
+		names[capture.Name] = true
+		if capture.URLPattern == "" {
+			c.addProblem(path+".url_pattern", "url_pattern is required")
+		}
+	}
+}
+
+func (c *configCompiler) compileBlock(block BlockConfig) {
+	switch c.compiled.Mode {
+	case ModeStatic, ModeJSON, ModeXML:
+		c.addProblem("block", "requests are only blocked in browser mode, not in %s mode", c.compiled.Mode)
+	}
+	for i, name := range block.ResourceTypes {
+		if _, ok := blockableResourceTypes[strings.ToLower(name)]; !ok {
+			c.addProblem(fmt.Sprintf("block.resource_types[%d]", i), "unsupported resource type %q", name)
+		}
+	}
+	for i, pattern := range block.URLPatterns {
+		if pattern == "" {
+			c.addProblem(fmt.Sprintf("block.url_patterns[%d]", i), "URL patterns must not be empty")
+		}
+	}
+}
+
+// compileNetworkField checks a field reading the responses of a network
+// capture, which select with path like the sub-fields of json fields.
+func (c *configCompiler) compileNetworkField(path string, field Field) {
+	switch c.compiled.Mode {
+	case ModeStatic, ModeJSON, ModeXML:
+		c.addProblem(path+".from", "from %q cannot be used in %s mode", FromNetwork, c.compiled.Mode)
+	}
+	if field.Type != FieldJSON {
+		c.addProblem(path+".type", "fields from %s must be of type json", FromNetwork)
+	}
+	if field.Selector != "" || len(field.Selectors) > 0 {
+		c.addProblem(path+".selector", "fields from %s select with path, not selector", FromNetwork)
+	}
+	switch {
+	case field.Capture != "":
+		found := false
+		for _, capture := range c.compiled.Network {
+			found = found || capture.Name == field.Capture
+		}
+		if !found {
+			c.addProblem(path+".capture", "unknown network capture %q", field.Capture)
+		}
+	case len(c.compiled.Network) == 0:
+		c.addProblem(path+".from", "the config has no network captures")
+	case len(c.compiled.Network) > 1:
+		c.addProblem(path+".capture", "capture is required when the config has several network captures")
+	}
+	if field.Path != "" {
+		c.compileJSONPath(path+".path", field.Path)
+	}
+	c.compileJSONFields(path, field.Fields)
+}
+
+func (c *configCompiler) compileDuration(path, value string) {
+	if d, err := time.ParseDuration(value); err != nil || d < 0 {
+		c.addProblem(path, "invalid duration %q", value)
+	}
+}
+
+func (c *configCompiler) compileIDConfig(path string, id IDConfig) {
+	for i, strategy := range id.Strategies {
+		switch strategy {
+		case IDFromPattern, IDFromURL, IDFromContent:
+		case IDFromFields:
+			if len(id.Fields) == 0 {
+				c.addProblem(path+".fields", "fields are required for the %s strategy", IDFromFields)
+			}
+		default:
+			c.addProblem(fmt.Sprintf("%s.strategies[%d]", path, i), "unsupported id strategy %q", strategy)
+		}
+	}
+	switch id.Namespace {
+	case "", IDNamespaceName, IDNamespaceEntityType, IDNamespaceNameEntityType:
+	default:
+		c.addProblem(path+".namespace", "unsupported namespace %q", id.Namespace)
+	}
+}
+
+func (c *configCompiler) compileFields(parent string, fields []Field) {
+	names := make(map[string]bool)
+	for i, field := range fields {
+		path := fmt.Sprintf("%s.fields[%d]", parent, i)
+		if field.Name == "" {
+			c.addProblem(path+".name", "name is required")
+		} else if names[field.Name] {
+			c.addProblem(path+".name", "duplicate field name %q", field.Name)
+		}
+		names[field.Name] = true
+		c.compileField(path, field)
+	}
+}
+
+func (c *configCompiler) compileField(path string, field Field) {
+	if field.Timezone != "" {
+		if _, err := time.LoadLocation(field.Timezone); err != nil {
+			c.addProblem(path+".timezone", "unknown timezone %q", field.Timezone)
+		}
+	}
+
+	c.compileTransforms(path, field.Transforms)
+	c.compileSelectorType(path, field.SelectorType)
+
+	switch field.OutputType {
+	case "", OutputString, OutputInt, OutputFloat, OutputBool, OutputDatetime, OutputURL, OutputArray, OutputObject:
+	default:
+		c.addProblem(path+".output_type", "unsupported output type %q", field.OutputType)
+	}
+
+	if strings.HasPrefix(field.Name, "_id") || strings.HasPrefix(field.Name, "_time") {
+		if field.Type == "nested" {
+			if len(field.Fields) == 0 {
+				c.addProblem(path+".fields", "at least one field is required")
+			}
+			c.compileFields(path, field.Fields)
+			return
+		}
+		switch field.From {
+		case FromURL:
+		case FromElement:
+			c.compileSelectors(path, field)
+		case "":
+			c.addProblem(path+".from", "from is required for %s fields", field.Name)
+		default:
+			c.addProblem(path+".from", "unsupported from %q", field.From)
+		}
+		if field.Pattern == "" {
+			c.addProblem(path+".pattern", "pattern is required for %s fields", field.Name)
+		} else {
+			c.compilePattern(path+".pattern", field.Pattern)
+		}
+		return
+	}
+
+	if field.Pattern != "" {
+		c.compilePattern(path+".pattern", field.Pattern)
+	}
+
+	if field.From == FromNetwork {
+		c.compileNetworkField(path, field)
+		return
+	}
+
+	switch field.Type {
+	case "text", "url", "html", "inner_html", "markdown":
+		c.compileSelectors(path, field)
+	case "attribute":
+		c.compileSelectors(path, field)
+		if field.Attribute == "" {
+			c.addProblem(path+".attribute", "attribute is required for attribute fields")
+		} else if !isValidAttributeGlob(field.Attribute) {
+			c.addProblem(path+".attribute", "invalid attribute pattern %q", field.Attribute)
+		}
+	case FieldJSONLD, FieldMicrodata, FieldRDFa, FieldOpenGraph:
+		// Structured data is read from the whole document unless a
+		// selector narrows it down.
+		if field.Selector != "" || len(field.Selectors) > 0 {
+			c.compileSelectors(path, field)
+		}
+		if field.Path != "" {
+			c.compileJSONPath(path+".path", field.Path)
+		}
+	case FieldJSON:
+		// Without a selector the text of the element itself is parsed.
+		if field.Selector != "" || len(field.Selectors) > 0 {
+			c.compileSelectors(path, field)
+		}
+		if field.Path != "" {
+			c.compileJSONPath(path+".path", field.Path)
+		}
+		c.compileJSONFields(path, field.Fields)
+	case FieldJS:
+		switch c.compiled.Mode {
+		case ModeStatic, ModeJSON, ModeXML:
+			c.addProblem(path+".type", "js fields cannot be used in %s mode", c.compiled.Mode)
+		}
+		if field.Script == "" {
+			c.addProblem(path+".script", "script is required for js fields")
+		}
+		// Without a selector the script runs on the element itself.
+		if field.Selector != "" || len(field.Selectors) > 0 {
+			c.compileSelectors(path, field)
+		}
+		if field.Path != "" {
+			c.compileJSONPath(path+".path", field.Path)
+		}
+		c.compileJSONFields(path, field.Fields)
+	case FieldTable:
+		c.compileSelectors(path, field)
+		switch field.TableFormat {
+		case "", TableRows, TableMap:
+		default:
+			c.addProblem(path+".table_format", "unsupported table format %q", field.TableFormat)
+		}
+	case "nested", "list":
+		c.compileSelectors(path, field)
+		if len(field.Fields) == 0 {
+			c.addProblem(path+".fields", "at least one field is required")
+		}
+		c.compileFields(path, field.Fields)
+	case "":
+		c.addProblem(path+".type", "type is required")
+	default:
+		c.addProblem(path+".type", "unsupported field type %q", field.Type)
+	}
+}
+
+// compileSelectors checks the selector chain of field. Selector may be left
+// empty when fallback Selectors are given.
+func (c *configCompiler) compileSelectors(path string, field Field) {
+	if field.Selector != "" || len(field.Selectors) == 0 {
+		c.compileSelector(path+".selector", field.SelectorType, field.Selector)
+	}
+	for i, selector := range field.Selectors {
+		c.compileSelector(fmt.Sprintf("%s.selectors[%d]", path, i), field.SelectorType, selector)
+	}
+}
+
+// compileJSONFields checks the sub-fields of a json field, which select
+// from the parsed value by path instead of from the page by selector.
+func (c *configCompiler) compileJSONFields(parent string, fields []Field) {
+	for i, field := range fields {
+		path := fmt.Sprintf("%s.fields[%d]", parent, i)
+		if field.Type != FieldJSON {
+			c.addProblem(path+".type", "fields of a json field must be of type json")
+		}
+		if field.Selector != "" || len(field.Selectors) > 0 {
+			c.addProblem(path+".selector", "fields of a json field select with path, not selector")
+		}
+	}
+	c.compileFields(parent, fields)
+}
+
+func (c *configCompiler) compileSelectorType(path, selectorType string) {
+	switch selectorType {
+	case SelectorCSS:
+		if c.compiled.Mode == ModeJSON || c.compiled.Mode == ModeXML {
+			c.addProblem(path+".selector_type", "selector type %q cannot be used in %s mode", selectorType, c.compiled.Mode)
+		}
+	case SelectorXPath:
+		if c.compiled.Mode == ModeJSON {
+			c.addProblem(path+".selector_type", "selector type %q cannot be used in %s mode", selectorType, ModeJSON)
+		}
+	case SelectorJSONPath:
+		if c.compiled.Mode != ModeJSON {
+			c.addProblem(path+".selector_type", "selector type %q requires %s mode", selectorType, ModeJSON)
+		}
+	default:
+		c.addProblem(path+".selector_type", "unsupported selector type %q", selectorType)
+	}
+}
+
+func (c *configCompiler) compileTransforms(parent string, transforms []Transform) {
+	for i, t := range transforms {
+		path := fmt.Sprintf("%s.transforms[%d]", parent, i)
+		switch t.Type {
+		case TransformRegexReplace, TransformRegexExtract:
+			if t.Pattern == "" {
+				c.addProblem(path+".pattern", "pattern is required for %s", t.Type)
+			} else {
+				c.compilePattern(path+".pattern", t.Pattern)
+			}
+			if t.Group != nil && *t.Group < 0 {
+				c.addProblem(path+".group", "group must not be negative")
+			}
+		case TransformDefault:
+			if t.Value == nil {
+				c.addProblem(path+".value", "value is required for %s", t.Type)
+			}
+		case TransformTrim, TransformSplit, TransformJoin, TransformLower, TransformUpper,
+			TransformStripHTML, TransformUnescape, TransformToInt, TransformToFloat, TransformToBool:
+		case "":
+			c.addProblem(path+".type", "type is required")
+		default:
+			c.addProblem(path+".type", "unsupported transform %q", t.Type)
+		}
+	}
+}
+
+func hasField(fields []Field, name string) bool {
+	for _, field := range fields {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// splitCountExpressions replaces every count(...) in selector with 0 and
+// returns the result together with the inner expressions.
+func splitCountExpressions(selector string) (string, []string) {
+	var inner []string
+	for {
+		start := strings.Index(selector, "count(")
+		if start == -1 {
+			return selector, inner
+		}
+		bracketCount := 1
+		end := start + 6
+		for end < len(selector) && bracketCount > 0 {
+			if selector[end] == '(' {
+				bracketCount++
+			} else if selector[end] == ')' {
+				bracketCount--
+			}
+			end++
+		}
+		if bracketCount != 0 {
+			return selector, inner
+		}
+		inner = append(inner, selector[start+6:end-1])
+		selector = selector[:start] + "0" + selector[end:]
+	}
+}
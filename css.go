@@ -0,0 +1,663 @@
+package extractor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// Selector types for Schema.SelectorType and Field.SelectorType.
+const (
+	SelectorXPath    string = "xpath"
+	SelectorCSS      string = "css"
+	SelectorJSONPath string = "jsonpath"
+)
+
+// cssSelector is a compiled CSS selector list. It is evaluated like
+// Element.querySelectorAll in a browser: the selector is matched against the
+// whole document, but only descendants of the context node are returned.
+type cssSelector []*cssComplex
+
+// cssComplex is a chain of compound selectors joined by combinators, stored
+// left to right.
+type cssComplex struct {
+	parts []cssPart
+}
+
+type cssPart struct {
+	// combinator joins the part to the previous one: ' ', '>', '+' or '~'.
+	combinator byte
+	match      cssMatcher
+}
+
+// cssMatcher reports whether the element n matches. scope is the element the
+// query runs on, or nil when it runs on the document.
+type cssMatcher func(n, scope *html.Node) bool
+
+// compileCSS parses a selector list such as "div.item > a[href], h2".
+func compileCSS(selector string) (cssSelector, error) {
+	p := &cssParser{s: selector}
+	list, err := p.parseSelectorList(false)
+	if err != nil {
+		return nil, err
+	}
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", p.peek())
+	}
+	return list, nil
+}
+
+// queryAll returns the elements below context matching s in document order,
+// or only the first one if first is set.
+func (s cssSelector) queryAll(context *html.Node, first bool) []*html.Node {
+	scope := context
+	if context.Type != html.ElementNode {
+		scope = nil
+	}
+	var result []*html.Node
+	var walk func(n *html.Node) bool
+	walk = func(n *html.Node) bool {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if s.matches(c, scope) {
+				result = append(result, c)
+				if first {
+					return true
+				}
+			}
+			if walk(c) {
+				return true
+			}
+		}
+		return false
+	}
+	walk(context)
+	return result
+}
+
+func (s cssSelector) matches(n, scope *html.Node) bool {
+	for _, c := range s {
+		if c.matchAt(len(c.parts)-1, n, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *cssComplex) matchAt(i int, n, scope *html.Node) bool {
+	if !c.parts[i].match(n, scope) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	switch c.parts[i].combinator {
+	case '>':
+		p := parentElement(n)
+		return p != nil && c.matchAt(i-1, p, scope)
+	case '+':
+		s := prevElement(n)
+		return s != nil && c.matchAt(i-1, s, scope)
+	case '~':
+		for s := prevElement(n); s != nil; s = prevElement(s) {
+			if c.matchAt(i-1, s, scope) {
+				return true
+			}
+		}
+	default:
+		for p := parentElement(n); p != nil; p = parentElement(p) {
+			if c.matchAt(i-1, p, scope) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parentElement(n *html.Node) *html.Node {
+	if p := n.Parent; p != nil && p.Type == html.ElementNode {
+		return p
+	}
+	return nil
+}
+
+func prevElement(n *html.Node) *html.Node {
+	for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+		if s.Type == html.ElementNode {
+			return s
+		}
+	}
+	return nil
+}
+
+func isRootElement(n *html.Node) bool {
+	return n.Parent != nil && n.Parent.Type == html.DocumentNode
+}
+
+func nodeAttribute(n *html.Node, name string) (string, bool) {
+	for _, attr := range n.Attr {
+		if strings.EqualFold(attr.Key, name) {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+// elementIndex returns the 1-based position of n among its element siblings,
+// counted from the end if fromEnd is set and among elements of the same
+// type only if ofType is set.
+func elementIndex(n *html.Node, fromEnd, ofType bool) int {
+	i := 1
+	next := func(s *html.Node) *html.Node {
+		if fromEnd {
+			return s.NextSibling
+		}
+		return s.PrevSibling
+	}
+	for s := next(n); s != nil; s = next(s) {
+		if s.Type == html.ElementNode && (!ofType || s.Data == n.Data) {
+			i++
+		}
+	}
+	return i
+}
+
+type cssParser struct {
+	s   string
+	pos int
+}
+
+func (p *cssParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *cssParser) peek() byte {
+	return p.s[p.pos]
+}
+
+func (p *cssParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid CSS selector at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// skipSpace skips whitespace and reports whether there was any.
+func (p *cssParser) skipSpace() bool {
+	start := p.pos
+	for !p.eof() && strings.IndexByte(" \t\n\r\f", p.peek()) >= 0 {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+// parseSelectorList parses comma separated selectors. Relative selectors,
+// as used by :has(), may start with a combinator and are anchored at the
+// element being tested.
+func (p *cssParser) parseSelectorList(relative bool) (cssSelector, error) {
+	var list cssSelector
+	for {
+		p.skipSpace()
+		c, err := p.parseComplex(relative)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+		if p.eof() || p.peek() != ',' {
+			return list, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *cssParser) parseComplex(relative bool) (*cssComplex, error) {
+	c := &cssComplex{}
+	var combinator byte
+	if relative {
+		combinator = ' '
+		if !p.eof() && strings.IndexByte(">+~", p.peek()) >= 0 {
+			combinator = p.peek()
+			p.pos++
+			p.skipSpace()
+		}
+		c.parts = append(c.parts, cssPart{match: func(n, scope *html.Node) bool {
+			return n == scope
+		}})
+	}
+	for {
+		match, err := p.parseCompound()
+		if err != nil {
+			return nil, err
+		}
+		c.parts = append(c.parts, cssPart{combinator: combinator, match: match})
+
+		space := p.skipSpace()
+		if p.eof() {
+			return c, nil
+		}
+		switch ch := p.peek(); {
+		case ch == '>' || ch == '+' || ch == '~':
+			combinator = ch
+			p.pos++
+			p.skipSpace()
+		case ch == ',' || ch == ')':
+			return c, nil
+		case space:
+			combinator = ' '
+		default:
+			return nil, p.errorf("unexpected %q", ch)
+		}
+	}
+}
+
+func (p *cssParser) parseCompound() (cssMatcher, error) {
+	var matchers []cssMatcher
+	start := p.pos
+	if !p.eof() && p.peek() == '*' {
+		p.pos++
+	} else if p.atIdentStart() {
+		tag, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, func(n, _ *html.Node) bool {
+			return strings.EqualFold(n.Data, tag)
+		})
+	}
+
+	for !p.eof() {
+		var match cssMatcher
+		var err error
+		switch p.peek() {
+		case '#':
+			p.pos++
+			var id string
+			if id, err = p.parseName(); err == nil {
+				match = func(n, _ *html.Node) bool {
+					value, ok := nodeAttribute(n, "id")
+					return ok && value == id
+				}
+			}
+		case '.':
+			p.pos++
+			var class string
+			if class, err = p.parseName(); err == nil {
+				match = func(n, _ *html.Node) bool {
+					value, _ := nodeAttribute(n, "class")
+					for _, c := range strings.Fields(value) {
+						if c == class {
+							return true
+						}
+					}
+					return false
+				}
+			}
+		case '[':
+			match, err = p.parseAttribute()
+		case ':':
+			match, err = p.parsePseudo()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if match == nil {
+			break
+		}
+		matchers = append(matchers, match)
+	}
+
+	if p.pos == start {
+		if p.eof() {
+			return nil, p.errorf("selector expected")
+		}
+		return nil, p.errorf("unexpected %q", p.peek())
+	}
+	return func(n, scope *html.Node) bool {
+		for _, match := range matchers {
+			if !match(n, scope) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func (p *cssParser) atIdentStart() bool {
+	if p.eof() {
+		return false
+	}
+	c := p.peek()
+	return c == '-' || c == '_' || c == '\\' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// parseName parses an identifier or name, resolving backslash escapes such
+// as "\31 23" or "md\:flex".
+func (p *cssParser) parseName() (string, error) {
+	var sb strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		switch {
+		case c == '\\':
+			p.pos++
+			if p.eof() {
+				return "", p.errorf("unfinished escape")
+			}
+			sb.WriteRune(p.parseEscape())
+		case c == '-' || c == '_' || c >= 0x80 || (c >= '0' && c <= '9') ||
+			(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+			sb.WriteRune(r)
+			p.pos += size
+		default:
+			if sb.Len() == 0 {
+				return "", p.errorf("name expected")
+			}
+			return sb.String(), nil
+		}
+	}
+	if sb.Len() == 0 {
+		return "", p.errorf("name expected")
+	}
+	return sb.String(), nil
+}
+
+// parseEscape parses the part of an escape after the backslash.
+func (p *cssParser) parseEscape() rune {
+	end := p.pos
+	for end < len(p.s) && end-p.pos < 6 && isHexDigit(p.s[end]) {
+		end++
+	}
+	if end == p.pos {
+		r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+		p.pos += size
+		return r
+	}
+	code, _ := strconv.ParseUint(p.s[p.pos:end], 16, 32)
+	p.pos = end
+	if !p.eof() && strings.IndexByte(" \t\n\r\f", p.peek()) >= 0 {
+		p.pos++
+	}
+	if code == 0 || code > utf8.MaxRune {
+		return utf8.RuneError
+	}
+	return rune(code)
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func (p *cssParser) parseString() (string, error) {
+	quote := p.peek()
+	p.pos++
+	var sb strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		switch c {
+		case quote:
+			p.pos++
+			return sb.String(), nil
+		case '\\':
+			p.pos++
+			if p.eof() {
+				return "", p.errorf("unfinished escape")
+			}
+			if p.peek() == '\n' {
+				p.pos++
+				continue
+			}
+			sb.WriteRune(p.parseEscape())
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// parseAttribute parses [name], [name=value] and the ~=, |=, ^=, $= and *=
+// operators, with an optional i flag for case-insensitive values.
+func (p *cssParser) parseAttribute() (cssMatcher, error) {
+	p.pos++
+	p.skipSpace()
+	name, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.eof() {
+		return nil, p.errorf("unterminated attribute selector")
+	}
+	if p.peek() == ']' {
+		p.pos++
+		return func(n, _ *html.Node) bool {
+			_, ok := nodeAttribute(n, name)
+			return ok
+		}, nil
+	}
+
+	op := ""
+	if strings.IndexByte("~|^$*", p.peek()) >= 0 {
+		op = p.s[p.pos : p.pos+1]
+		p.pos++
+	}
+	if p.eof() || p.peek() != '=' {
+		return nil, p.errorf("attribute operator expected")
+	}
+	p.pos++
+	p.skipSpace()
+	if p.eof() {
+		return nil, p.errorf("attribute value expected")
+	}
+	var value string
+	if c := p.peek(); c == '"' || c == '\'' {
+		value, err = p.parseString()
+	} else {
+		value, err = p.parseName()
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	ignoreCase := false
+	if !p.eof() && (p.peek() == 'i' || p.peek() == 'I' || p.peek() == 's' || p.peek() == 'S') {
+		ignoreCase = p.peek() == 'i' || p.peek() == 'I'
+		p.pos++
+		p.skipSpace()
+	}
+	if p.eof() || p.peek() != ']' {
+		return nil, p.errorf("] expected")
+	}
+	p.pos++
+
+	if ignoreCase {
+		value = strings.ToLower(value)
+	}
+	return func(n, _ *html.Node) bool {
+		attr, ok := nodeAttribute(n, name)
+		if !ok {
+			return false
+		}
+		if ignoreCase {
+			attr = strings.ToLower(attr)
+		}
+		switch op {
+		case "~":
+			for _, word := range strings.Fields(attr) {
+				if word == value {
+					return true
+				}
+			}
+			return false
+		case "|":
+			return attr == value || strings.HasPrefix(attr, value+"-")
+		case "^":
+			return value != "" && strings.HasPrefix(attr, value)
+		case "$":
+			return value != "" && strings.HasSuffix(attr, value)
+		case "*":
+			return value != "" && strings.Contains(attr, value)
+		}
+		return attr == value
+	}, nil
+}
+
+// parsePseudo parses the supported pseudo-classes: the structural ones,
+// :root, :scope, :empty, :not(), :is(), :where() and :has().
+func (p *cssParser) parsePseudo() (cssMatcher, error) {
+	p.pos++
+	if !p.eof() && p.peek() == ':' {
+		return nil, p.errorf("pseudo-elements are not supported")
+	}
+	name, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+	name = strings.ToLower(name)
+
+	if p.eof() || p.peek() != '(' {
+		switch name {
+		case "root":
+			return func(n, _ *html.Node) bool { return isRootElement(n) }, nil
+		case "scope":
+			return func(n, scope *html.Node) bool {
+				if scope == nil {
+					return isRootElement(n)
+				}
+				return n == scope
+			}, nil
+		case "empty":
+			return func(n, _ *html.Node) bool {
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					if c.Type == html.ElementNode || (c.Type == html.TextNode && c.Data != "") {
+						return false
+					}
+				}
+				return true
+			}, nil
+		case "first-child":
+			return nthMatcher(0, 1, false, false), nil
+		case "last-child":
+			return nthMatcher(0, 1, true, false), nil
+		case "first-of-type":
+			return nthMatcher(0, 1, false, true), nil
+		case "last-of-type":
+			return nthMatcher(0, 1, true, true), nil
+		case "only-child":
+			return func(n, _ *html.Node) bool {
+				return elementIndex(n, false, false) == 1 && elementIndex(n, true, false) == 1
+			}, nil
+		case "only-of-type":
+			return func(n, _ *html.Node) bool {
+				return elementIndex(n, false, true) == 1 && elementIndex(n, true, true) == 1
+			}, nil
+		}
+		return nil, p.errorf("unsupported pseudo-class :%s", name)
+	}
+
+	p.pos++
+	var match cssMatcher
+	switch name {
+	case "not", "is", "where", "has":
+		list, err := p.parseSelectorList(name == "has")
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "not":
+			match = func(n, scope *html.Node) bool { return !list.matches(n, scope) }
+		case "has":
+			match = func(n, _ *html.Node) bool { return hasMatch(list, n) }
+		default:
+			match = func(n, scope *html.Node) bool { return list.matches(n, scope) }
+		}
+	case "nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type":
+		end := strings.IndexByte(p.s[p.pos:], ')')
+		if end < 0 {
+			return nil, p.errorf(") expected")
+		}
+		a, b, err := parseNth(p.s[p.pos : p.pos+end])
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		p.pos += end
+		match = nthMatcher(a, b, strings.Contains(name, "last"), strings.HasSuffix(name, "of-type"))
+	default:
+		return nil, p.errorf("unsupported pseudo-class :%s()", name)
+	}
+	p.skipSpace()
+	if p.eof() || p.peek() != ')' {
+		return nil, p.errorf(") expected")
+	}
+	p.pos++
+	return match, nil
+}
+
+// hasMatch reports whether any element after n, that is a descendant or a
+// following sibling subtree, matches the relative selector list anchored at
+// n.
+func hasMatch(list cssSelector, n *html.Node) bool {
+	var walk func(c *html.Node) bool
+	walk = func(c *html.Node) bool {
+		for ; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if list.matches(c, n) || walk(c.FirstChild) {
+				return true
+			}
+		}
+		return false
+	}
+	return walk(n.FirstChild) || walk(n.NextSibling)
+}
+
+func nthMatcher(a, b int, fromEnd, ofType bool) cssMatcher {
+	return func(n, _ *html.Node) bool {
+		i := elementIndex(n, fromEnd, ofType)
+		if a == 0 {
+			return i == b
+		}
+		return (i-b)/a >= 0 && (i-b)%a == 0
+	}
+}
+
+// parseNth parses the an+b argument of the :nth-* pseudo-classes.
+func parseNth(s string) (int, int, error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+	switch s {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	}
+	i := strings.IndexByte(s, 'n')
+	if i < 0 {
+		b, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid nth argument %q", s)
+		}
+		return 0, b, nil
+	}
+	a, b := 1, 0
+	switch coefficient := s[:i]; coefficient {
+	case "", "+":
+	case "-":
+		a = -1
+	default:
+		var err error
+		if a, err = strconv.Atoi(coefficient); err != nil {
+			return 0, 0, fmt.Errorf("invalid nth argument %q", s)
+		}
+	}
+	if rest := s[i+1:]; rest != "" {
+		var err error
+		if b, err = strconv.Atoi(strings.TrimPrefix(rest, "+")); err != nil || (rest[0] != '+' && rest[0] != '-') {
+			return 0, 0, fmt.Errorf("invalid nth argument %q", s)
+		}
+	}
+	return a, b, nil
+}
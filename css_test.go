@@ -0,0 +1,153 @@
+package extractor
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+const cssFixture = `<html id="html"><body id="body">
+<div id="main" class="content main">
+  <h2 id="title" lang="en-US">Title</h2>
+  <ul id="list">
+    <li id="li1" class="item first" data-sku="a-1"><a id="a1" href="/one">One</a></li>
+    <li id="li2" class="item" data-sku="b-2"><a id="a2" href="https://example.com/two">Two</a></li>
+    <li id="li3" class="item sold-out" data-sku="c-3"></li>
+    <li id="li4" class="item"><span id="s4">Four</span></li>
+  </ul>
+  <p id="p1">First</p>
+  <p id="p2"></p>
+</div>
+<div id="aside" class="md:flex"><p id="p3">Aside</p></div>
+</body></html>`
+
+func parseCSSFixture(t *testing.T) *html.Node {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader(cssFixture))
+	if err != nil {
+		t.Fatalf("failed to parse fixture: %v", err)
+	}
+	return doc
+}
+
+func findByID(n *html.Node, id string) *html.Node {
+	if value, ok := nodeAttribute(n, "id"); ok && n.Type == html.ElementNode && value == id {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findByID(c, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func matchedIDs(nodes []*html.Node) string {
+	ids := make([]string, len(nodes))
+	for i, n := range nodes {
+		ids[i], _ = nodeAttribute(n, "id")
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestCSSQueryAll(t *testing.T) {
+	doc := parseCSSFixture(t)
+	tests := []struct {
+		selector string
+		context  string
+		want     string
+	}{
+		{selector: "li", want: "li1 li2 li3 li4"},
+		{selector: "LI", want: "li1 li2 li3 li4"},
+		{selector: "#title", want: "title"},
+		{selector: ".item.first", want: "li1"},
+		{selector: "div.content > ul > li > a", want: "a1 a2"},
+		{selector: "#main p", want: "p1 p2"},
+		{selector: "h2 + ul", want: "list"},
+		{selector: "h2 ~ p", want: "p1 p2"},
+		{selector: "h2, p", want: "title p1 p2 p3"},
+		{selector: "[data-sku]", want: "li1 li2 li3"},
+		{selector: `[data-sku="b-2"]`, want: "li2"},
+		{selector: "[class~=sold-out]", want: "li3"},
+		{selector: "[lang|=en]", want: "title"},
+		{selector: "a[href^=https]", want: "a2"},
+		{selector: `a[href$="/one"]`, want: "a1"},
+		{selector: "[data-sku*='-']", want: "li1 li2 li3"},
+		{selector: "[data-sku='A-1' i]", want: "li1"},
+		{selector: "[data-sku='A-1' s]", want: ""},
+		{selector: `.md\:flex`, want: "aside"},
+		{selector: "li:first-child", want: "li1"},
+		{selector: "li:last-child", want: "li4"},
+		{selector: "li:nth-child(2n)", want: "li2 li4"},
+		{selector: "li:nth-child(odd)", want: "li1 li3"},
+		{selector: "li:nth-child(-n+2)", want: "li1 li2"},
+		{selector: "li:nth-last-child(1)", want: "li4"},
+		{selector: "p:first-of-type", want: "p1 p3"},
+		{selector: "p:last-of-type", want: "p2 p3"},
+		{selector: "p:only-of-type", want: "p3"},
+		{selector: "a:only-child", want: "a1 a2"},
+		{selector: "li:empty", want: "li3"},
+		{selector: "li:not(.first, :empty)", want: "li2 li4"},
+		{selector: "li:is(#li2, #li4) > *", want: "a2 s4"},
+		{selector: "li:where(.sold-out)", want: "li3"},
+		{selector: "li:has(span)", want: "li4"},
+		{selector: "li:has(> a[href^='/'])", want: "li1"},
+		{selector: "h2:has(+ ul)", want: "title"},
+		{selector: "div:has(~ div)", want: "main"},
+		{selector: ":root", want: "html"},
+		{selector: "*", context: "li1", want: "a1"},
+		{selector: ":scope > li:nth-child(3)", context: "list", want: "li3"},
+		{selector: "div li", context: "list", want: "li1 li2 li3 li4"},
+		{selector: ":scope", context: "list", want: ""},
+		{selector: "p", context: "aside", want: "p3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			sel, err := compileCSS(tt.selector)
+			if err != nil {
+				t.Fatalf("compileCSS(%q) failed: %v", tt.selector, err)
+			}
+			context := doc
+			if tt.context != "" {
+				context = findByID(doc, tt.context)
+			}
+			if got := matchedIDs(sel.queryAll(context, false)); got != tt.want {
+				t.Errorf("queryAll(%q) = %q, want %q", tt.selector, got, tt.want)
+			}
+			first := sel.queryAll(context, true)
+			if want := strings.Fields(tt.want); len(want) > 0 {
+				if got := matchedIDs(first); got != want[0] {
+					t.Errorf("first match of %q = %q, want %q", tt.selector, got, want[0])
+				}
+			} else if len(first) > 0 {
+				t.Errorf("first match of %q = %q, want none", tt.selector, matchedIDs(first))
+			}
+		})
+	}
+}
+
+func TestCompileCSSErrors(t *testing.T) {
+	for _, selector := range []string{
+		"",
+		"div >",
+		"div,",
+		"div!",
+		"[href",
+		"[href=]",
+		"[href^]",
+		"[href='x'",
+		"a::before",
+		":hover",
+		":nth-child(x)",
+		":nth-child(2n",
+		":not(a",
+		":contains(x)",
+		".",
+		"#",
+	} {
+		if _, err := compileCSS(selector); err == nil {
+			t.Errorf("compileCSS(%q) succeeded, want an error", selector)
+		}
+	}
+}
@@ -1,20 +1,57 @@
 package extractor
 
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
 const (
 	FromURL     string = "url"
 	FromElement string = "element"
 )
 
+const (
+	StatusSuccess string = "success"
+	StatusPartial string = "partial"
+	StatusFailed  string = "failed"
+)
+
+const (
+	ModeStatic  string = "static"
+	ModeBrowser string = "browser"
+	ModeAuto    string = "auto"
+	ModeJSON    string = "json"
+	ModeXML     string = "xml"
+)
+
 type Extractor interface {
 	Extract(url string) (*ExtractionResult, error)
 	ExtractWithoutCache(url string) (*ExtractionResult, error)
+	ExtractContext(ctx context.Context, url string) (*ExtractionResult, error)
+	ExtractWithoutCacheContext(ctx context.Context, url string) (*ExtractionResult, error)
 }
 
 func NewExtractor(config ExtractorConfig) Extractor {
-	if config.Mode == "static" {
+	return NewExtractorWithPool(config, nil)
+}
+
+// NewExtractorWithPool is like NewExtractor, but the browser and auto
+// extractors take their pages from pool so that several extractors can
+// share browsers.
+func NewExtractorWithPool(config ExtractorConfig, pool *BrowserPool) Extractor {
+	config = applyPreset(config)
+	switch config.Mode {
+	case ModeStatic:
 		return NewStaticExtractor(config)
+	case ModeAuto:
+		return NewAutoExtractorWithPool(config, pool)
+	case ModeJSON:
+		return NewJSONExtractor(config)
+	case ModeXML:
+		return NewXMLExtractor(config)
 	}
-	return NewBrowserExtractor(config)
+	return NewBrowserExtractorWithPool(config, pool)
 }
 
 type ExtractorConfig struct {
@@ -23,6 +60,21 @@ type ExtractorConfig struct {
 	ExampleURL string   `json:"example_url"`
 	Mode       string   `json:"mode"`
 	Schemas    []Schema `json:"schemas"`
+	// Preset adds built-in schemas; "feed" extracts RSS and Atom entries in
+	// xml mode.
+	Preset string `json:"preset,omitempty"`
+	// Namespaces maps the prefixes XPath selectors use in xml mode to
+	// namespace URIs, in addition to the common feed namespaces.
+	Namespaces map[string]string `json:"namespaces,omitempty"`
+	// Actions run in order on the page in browser mode before the schemas
+	// are extracted.
+	Actions []Action `json:"actions,omitempty"`
+	// Network records responses the page loads in browser mode for fields
+	// with from set to network.
+	Network []NetworkCapture `json:"network,omitempty"`
+	// Block lists requests the browser skips in browser mode, such as
+	// images, fonts and trackers.
+	Block *BlockConfig `json:"block,omitempty"`
 }
 
 type Schema struct {
@@ -31,6 +83,18 @@ type Schema struct {
 	Selector   string  `json:"selector"`
 	Type       string  `json:"type"`
 	Fields     []Field `json:"fields,omitempty"`
+	// SelectorType is xpath (the default) or css. It applies to Selector and
+	// is inherited by fields that do not set their own.
+	SelectorType string `json:"selector_type,omitempty"`
+	// MinItems is the number of items below which the page is considered
+	// failed.
+	MinItems int `json:"min_items,omitempty"`
+	// RequiredFields lists fields every item must have; items missing one
+	// are dropped, like items missing a field marked Required.
+	RequiredFields []string `json:"required_fields,omitempty"`
+	// ID configures how external_id is generated. Without it external_id
+	// is built from the _id fields only.
+	ID *IDConfig `json:"id,omitempty"`
 }
 
 type Field struct {
@@ -40,7 +104,59 @@ type Field struct {
 	Pattern   string  `json:"pattern"`
 	Type      string  `json:"type"`
 	Attribute string  `json:"attribute,omitempty"`
+	Required  bool    `json:"required,omitempty"`
 	Fields    []Field `json:"fields,omitempty"`
+	// SelectorType is xpath or css and defaults to the type of the enclosing
+	// field or schema.
+	SelectorType string `json:"selector_type,omitempty"`
+	// Selectors are fallbacks tried in order after Selector until one
+	// matches, for pages that come in several layouts.
+	Selectors []string `json:"selectors,omitempty"`
+	// ItemType keeps only structured data items of this @type, e.g.
+	// Product; for opengraph fields it is matched against og:type.
+	ItemType string `json:"item_type,omitempty"`
+	// Path is a JSONPath expression evaluated on structured data items and
+	// on the value of json and js fields.
+	Path string `json:"path,omitempty"`
+	// Multiple makes structured data, json and attribute fields return
+	// every match as a list instead of the first one.
+	Multiple bool `json:"multiple,omitempty"`
+	// Default is used when the field cannot be extracted or is empty.
+	Default interface{} `json:"default,omitempty"`
+	// Transforms are applied in order to the extracted value.
+	Transforms []Transform `json:"transforms,omitempty"`
+	// Resolve makes attribute fields return an absolute URL, like url
+	// fields, and rewrites the links of html, inner_html and markdown fields
+	// to absolute URLs.
+	Resolve bool `json:"resolve,omitempty"`
+	// Sanitize restricts html, inner_html and markdown fields to a safe
+	// allowlist of tags and attributes.
+	Sanitize bool `json:"sanitize,omitempty"`
+	// TableFormat is how table fields are returned: rows, a list of objects
+	// keyed by column header, or map, an object mapping the first column to
+	// the second. By default two-column tables without a header row are
+	// returned as maps and others as rows.
+	TableFormat string `json:"table_format,omitempty"`
+	// Headers names the columns of table fields. The table's own header
+	// rows are skipped and every other row is data.
+	Headers []string `json:"headers,omitempty"`
+	// Capture names the network capture json fields with from set to
+	// network read. It may be left empty when the config has only one.
+	Capture string `json:"capture,omitempty"`
+	// Script is the JavaScript expression js fields evaluate in the browser,
+	// with the element bound to this and el, e.g. "window.dataLayer" or
+	// "getComputedStyle(el).color".
+	Script string `json:"script,omitempty"`
+	// OutputType declares the type of the value in the item; the extracted
+	// value is coerced to it after the transforms ran.
+	OutputType string `json:"output_type,omitempty"`
+
+	// Layout, Layouts and Timezone control how _time fields and datetime
+	// output types are parsed. Configured layouts are tried before the
+	// built-in formats.
+	Layout   string   `json:"layout,omitempty"`
+	Layouts  []string `json:"layouts,omitempty"`
+	Timezone string   `json:"timezone,omitempty"`
 }
 
 type ExtractedItem map[string]interface{}
@@ -49,11 +165,33 @@ type ExtractionResult struct {
 	SchemaResults map[string]SchemaResult
 	Errors        []ExtractionError
 	FinalURL      string
+	// Mode is the extraction mode that produced the result, static or browser.
+	Mode string
+	// Status is the page-level outcome: success, partial when fields failed
+	// or items were dropped, or failed when no valid item was produced or a
+	// schema got fewer than its MinItems.
+	Status string
+	// Debug holds diagnostics about the extraction.
+	Debug DebugInfo
+}
+
+// DebugInfo holds diagnostics that help maintain configs.
+type DebugInfo struct {
+	// SelectorHits maps the path of every field with fallback selectors,
+	// e.g. products.price, to how often each selector of the chain was the
+	// one that matched, in chain order. Selectors that never match show up
+	// as zeros.
+	SelectorHits map[string][]int
+	// BlockedRequests counts the requests blocked in browser mode by
+	// resource type, e.g. image or font.
+	BlockedRequests map[string]int
 }
 
 type SchemaResult struct {
 	Schema SchemaInfo
 	Items  []ExtractedItem
+	// Dropped counts the items that broke the schema rules.
+	Dropped int
 }
 
 type SchemaInfo struct {
@@ -66,3 +204,41 @@ type ExtractionError struct {
 	Message string
 	URL     string
 }
+
+// TimeoutError is returned when an extraction is cancelled or runs past the
+// deadline of its context.
+type TimeoutError struct {
+	URL string
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("extraction of %s aborted: %v", e.URL, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the extraction hit a deadline rather than being
+// cancelled explicitly.
+func (e *TimeoutError) Timeout() bool {
+	return errors.Is(e.Err, context.DeadlineExceeded)
+}
+
+// checkContext returns a *TimeoutError if ctx is already done.
+func checkContext(ctx context.Context, url string) error {
+	if err := ctx.Err(); err != nil {
+		return &TimeoutError{URL: url, Err: err}
+	}
+	return nil
+}
+
+// contextError prefers a *TimeoutError over err when ctx is done, since the
+// underlying failure is most likely a consequence of the cancellation.
+func contextError(ctx context.Context, url string, err error) error {
+	if cerr := checkContext(ctx, url); cerr != nil {
+		return cerr
+	}
+	return err
+}
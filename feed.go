@@ -0,0 +1,80 @@
+package extractor
+
+// Presets for ExtractorConfig.Preset.
+const (
+	// PresetFeed extracts the entries of RSS 0.9x/1.0/2.0 and Atom feeds.
+	PresetFeed string = "feed"
+)
+
+// FeedSchemaName is the name of the schema added by PresetFeed.
+const FeedSchemaName = "entries"
+
+// trimmedPattern captures a whole value without surrounding whitespace.
+const trimmedPattern = `(?s)^\s*(.+?)\s*$`
+
+// applyPreset returns config with the mode and schemas of its preset filled
+// in. A schema of the same name in the config replaces the preset's.
+func applyPreset(config ExtractorConfig) ExtractorConfig {
+	if config.Preset != PresetFeed {
+		return config
+	}
+	if config.Mode == "" {
+		config.Mode = ModeXML
+	}
+	for _, schema := range config.Schemas {
+		if schema.Name == FeedSchemaName {
+			return config
+		}
+	}
+	config.Schemas = append(append([]Schema(nil), config.Schemas...), feedSchema())
+	return config
+}
+
+// feedSchema maps RSS items and Atom entries to items. The item selector
+// matches by local name so that RSS 1.0 and prefixed Atom work too; fields
+// try the RSS element first and the Atom one after it. external_id comes
+// from guid or id, falling back to a hash of the link, and external_time
+// from pubDate, published, updated or dc:date.
+func feedSchema() Schema {
+	return Schema{
+		Name:         FeedSchemaName,
+		EntityType:   "entry",
+		SelectorType: SelectorXPath,
+		Selector:     "//*[local-name()='item' or local-name()='entry']",
+		Fields: []Field{
+			{Name: "title", Type: "text", Selectors: []string{"title", "atom:title"}},
+			{Name: "link", Type: "url", Selectors: []string{
+				"*[local-name()='link'][not(@rel) or @rel='alternate']",
+				"guid[not(@isPermaLink='false')]",
+			}},
+			{Name: "summary", Type: "inner_html", Resolve: true, Default: "", Selectors: []string{
+				"description", "atom:summary", "summary",
+			}},
+			{Name: "content", Type: "inner_html", Resolve: true, Default: "", Selectors: []string{
+				"content:encoded", "atom:content", "content",
+			}},
+			{Name: "author", Type: "text", Default: "", Selectors: []string{
+				"*[local-name()='author']/*[local-name()='name']", "dc:creator", "author", "itunes:author",
+			}},
+			{Name: "categories", Type: "list", Default: []interface{}{},
+				Selector: "category[not(@term)] | dc:subject | *[local-name()='category']/@term",
+				Fields:   []Field{{Name: "category", Type: "text", Selector: "."}},
+			},
+			{Name: "_id", Type: "text", From: FromElement, Pattern: trimmedPattern, Default: "", Selectors: []string{
+				"guid", "id", "atom:id",
+			}},
+			{Name: "_time", Type: "text", From: FromElement, Pattern: trimmedPattern, Selectors: []string{
+				"pubDate", "published", "updated", "dc:date", "atom:published", "atom:updated",
+			}, Layouts: []string{
+				"Mon, 2 Jan 2006 15:04:05 -0700",
+				"Mon, 2 Jan 2006 15:04:05 MST",
+				"2 Jan 2006 15:04:05 -0700",
+			}},
+		},
+		ID: &IDConfig{
+			Strategies:   []string{IDFromPattern, IDFromURL},
+			URLField:     "link",
+			PreserveCase: true,
+		},
+	}
+}
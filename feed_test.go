@@ -0,0 +1,185 @@
+package extractor
+
+import (
+	"testing"
+	"time"
+)
+
+const rss2Fixture = `<?xml version="1.0" encoding="ISO-8859-1"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:d="http://purl.org/dc/elements/1.1/" xmlns:atom="http://www.w3.org/2005/Atom">
+<channel>
+  <title>Channel</title>
+  <link>https://example.com/</link>
+  <atom:link rel="self" href="https://example.com/feed.xml"/>
+  <item>
+    <title>Caf&eacute; news</title>
+    <link>/posts/1</link>
+    <description>&lt;p&gt;Hello &lt;a href="/about"&gt;there&lt;/a&gt;&lt;/p&gt;</description>
+    <content:encoded><![CDATA[<p>Full <img src="/img.png"></p>]]></content:encoded>
+    <d:creator>Ann</d:creator>
+    <category>Tech</category>
+    <category>Go</category>
+    <guid isPermaLink="false">post-1</guid>
+    <pubDate>Tue, 3 Mar 2020 10:00:00 +0000</pubDate>
+  </item>
+  <item>
+    <title>Permalink</title>
+    <guid>https://example.com/posts/2</guid>
+    <d:date>2020-03-04T10:00:00Z</d:date>
+  </item>
+</channel>
+</rss>`
+
+const atomFixture = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Feed</title>
+  <entry>
+    <title>First entry</title>
+    <link rel="edit" href="https://example.org/edit/1"/>
+    <link rel="alternate" href="https://example.org/entries/1"/>
+    <id>urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a</id>
+    <published>2021-01-02T03:04:05Z</published>
+    <updated>2021-01-03T00:00:00Z</updated>
+    <author><name>Bob</name></author>
+    <category term="news"/>
+    <summary type="html">&lt;b&gt;Summary&lt;/b&gt;</summary>
+  </entry>
+  <entry>
+    <title>Second entry</title>
+    <link href="https://example.org/entries/2"/>
+    <id>tag:example.org,2021:2</id>
+    <updated>2021-02-01T12:00:00+02:00</updated>
+  </entry>
+</feed>`
+
+const prefixedAtomFixture = `<?xml version="1.0"?>
+<a:feed xmlns:a="http://www.w3.org/2005/Atom">
+  <a:entry>
+    <a:title>Prefixed</a:title>
+    <a:link href="https://example.net/p"/>
+    <a:id>urn:p</a:id>
+    <a:updated>2022-05-06T07:08:09Z</a:updated>
+  </a:entry>
+</a:feed>`
+
+func TestFeedPreset(t *testing.T) {
+	tests := []struct {
+		name    string
+		feed    string
+		baseURL string
+		want    []ExtractedItem
+	}{
+		{
+			name:    "rss 2.0",
+			feed:    rss2Fixture,
+			baseURL: "https://example.com/feed.xml",
+			want: []ExtractedItem{
+				{
+					"title":         "Café news",
+					"link":          "https://example.com/posts/1",
+					"external_id":   "post-1",
+					"external_time": time.Date(2020, 3, 3, 10, 0, 0, 0, time.UTC),
+					"author":        "Ann",
+					"summary":       `<p>Hello <a href="https://example.com/about">there</a></p>`,
+					"content":       `<p>Full <img src="https://example.com/img.png"/></p>`,
+					"categories":    []string{"Tech", "Go"},
+				},
+				{
+					"title":         "Permalink",
+					"link":          "https://example.com/posts/2",
+					"external_id":   "https://example.com/posts/2",
+					"external_time": time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC),
+					"author":        "",
+				},
+			},
+		},
+		{
+			name:    "atom",
+			feed:    atomFixture,
+			baseURL: "https://example.org/feed",
+			want: []ExtractedItem{
+				{
+					"title":         "First entry",
+					"link":          "https://example.org/entries/1",
+					"external_id":   "urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a",
+					"external_time": time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+					"author":        "Bob",
+					"summary":       "<b>Summary</b>",
+					"categories":    []string{"news"},
+				},
+				{
+					"title":         "Second entry",
+					"link":          "https://example.org/entries/2",
+					"external_id":   "tag:example.org,2021:2",
+					"external_time": time.Date(2021, 2, 1, 10, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			name:    "prefixed atom",
+			feed:    prefixedAtomFixture,
+			baseURL: "https://example.net/feed",
+			want: []ExtractedItem{
+				{
+					"title":         "Prefixed",
+					"link":          "https://example.net/p",
+					"external_id":   "urn:p",
+					"external_time": time.Date(2022, 5, 6, 7, 8, 9, 0, time.UTC),
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewXMLExtractor(ExtractorConfig{Preset: PresetFeed})
+			result, err := e.ExtractXML([]byte(tt.feed), tt.baseURL)
+			if err != nil {
+				t.Fatalf("ExtractXML failed: %v", err)
+			}
+			if result.Status != StatusSuccess {
+				t.Errorf("status = %s, want %s; errors: %v", result.Status, StatusSuccess, result.Errors)
+			}
+			items := result.SchemaResults[FeedSchemaName].Items
+			if len(items) != len(tt.want) {
+				t.Fatalf("got %d items, want %d: %v", len(items), len(tt.want), items)
+			}
+			for i, want := range tt.want {
+				checkItem(t, i, items[i], want)
+			}
+		})
+	}
+}
+
+// checkItem compares the fields listed in want with those of item.
+func checkItem(t *testing.T, i int, item, want ExtractedItem) {
+	t.Helper()
+	for name, wantValue := range want {
+		got, ok := item[name]
+		if !ok {
+			t.Errorf("item %d: %s missing", i, name)
+			continue
+		}
+		switch wantValue := wantValue.(type) {
+		case time.Time:
+			if gotTime, ok := got.(time.Time); !ok || !gotTime.Equal(wantValue) {
+				t.Errorf("item %d: %s = %v, want %v", i, name, got, wantValue)
+			}
+		case []string:
+			gotStrings, ok := got.([]string)
+			if !ok || len(gotStrings) != len(wantValue) {
+				t.Errorf("item %d: %s = %#v, want %#v", i, name, got, wantValue)
+				continue
+			}
+			for j := range wantValue {
+				if gotStrings[j] != wantValue[j] {
+					t.Errorf("item %d: %s = %#v, want %#v", i, name, got, wantValue)
+					break
+				}
+			}
+		default:
+			if got != wantValue {
+				t.Errorf("item %d: %s = %#v, want %#v", i, name, got, wantValue)
+			}
+		}
+	}
+}
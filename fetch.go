@@ -0,0 +1,113 @@
+package extractor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/crawlerclub/httpcache"
+	"github.com/liuzl/store"
+	"github.com/projectdiscovery/useragent"
+)
+
+// pageCache fetches pages through the httpcache store. It uses the same
+// store, keys and policies as httpcache.GetClient, configured by the same
+// -cache_dir and -policies_file flags, but makes the requests itself so
+// that they carry the context of the extraction and stop when it is done.
+type pageCache struct {
+	cache  *httpcache.Cache
+	client *http.Client
+}
+
+var (
+	sharedCacheOnce sync.Once
+	sharedCache     *pageCache
+	sharedCacheErr  error
+)
+
+// getPageCache opens the shared page cache on first use.
+func getPageCache() (*pageCache, error) {
+	sharedCacheOnce.Do(func() {
+		policies, err := httpcache.LoadPoliciesFromFile(flagValue("policies_file", ".httpcache/policies.txt"))
+		if err != nil {
+			sharedCacheErr = fmt.Errorf("failed to load cache policies: %v", err)
+			return
+		}
+		s, err := store.NewLevelStore(flagValue("cache_dir", ".httpcache") + "/data")
+		if err != nil {
+			sharedCacheErr = fmt.Errorf("failed to open cache: %v", err)
+			return
+		}
+		sharedCache = &pageCache{
+			cache:  &httpcache.Cache{Store: s, Policies: policies},
+			client: &http.Client{},
+		}
+	})
+	return sharedCache, sharedCacheErr
+}
+
+// flagValue returns the value of the command line flag name, which
+// httpcache registers, or def if it is not registered.
+func flagValue(name, def string) string {
+	if f := flag.Lookup(name); f != nil {
+		return f.Value.String()
+	}
+	return def
+}
+
+// cacheKey is the key httpcache stores url under.
+func cacheKey(url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(hash[:])
+}
+
+// fetch returns the body of url and the URL it was served from after
+// redirects. With cache set a cached copy is used if there is one; fetched
+// pages are stored whenever a cache policy matches url.
+func (c *pageCache) fetch(ctx context.Context, url string, cache bool) ([]byte, string, error) {
+	if err := checkContext(ctx, url); err != nil {
+		return nil, "", err
+	}
+	ttl := c.cache.GetTTL(url)
+	if cache && ttl > 0 {
+		if body, finalURL, found := c.cache.Get(cacheKey(url)); found {
+			if finalURL == "" {
+				// Entries stored by httpcache's Fetch lack the final URL.
+				finalURL = url
+			}
+			return body, finalURL, nil
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", useragent.UserAgents[0].String())
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, "", contextError(ctx, url, err)
+	}
+	defer resp.Body.Close()
+
+	finalURL := resp.Request.URL.String()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, finalURL, contextError(ctx, url, err)
+	}
+	if ttl > 0 {
+		c.cache.Set(cacheKey(url), body, url, finalURL, ttl)
+	}
+	return body, finalURL, nil
+}
+
+// forget removes the cached copy of url, so that broken pages are fetched
+// again next time.
+func (c *pageCache) forget(url string) {
+	_ = c.cache.Delete(cacheKey(url))
+}
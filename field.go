@@ -0,0 +1,765 @@
+package extractor
+
+import (
+	"context"
+	"fmt"
+	neturl "net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// extractSchemas applies every schema to the document root and records the
+// items and errors in result. Items that break the schema rules are dropped
+// and result.Status is set from the page-level outcome.
+func extractSchemas(ctx context.Context, config *CompiledConfig, root node, url string, result *ExtractionResult) error {
+	pageURL := result.FinalURL
+	if pageURL == "" {
+		pageURL = url
+	}
+	result.Debug.SelectorHits = make(map[string][]int)
+	ev := &evaluator{
+		config:  config,
+		root:    root,
+		baseURL: documentBaseURL(root, pageURL),
+		hits:    result.Debug.SelectorHits,
+	}
+	total, failed, partial := 0, false, false
+
+	// Extract items for each schema
+	for _, schema := range config.Schemas {
+		if err := checkContext(ctx, url); err != nil {
+			return err
+		}
+		schemaResult := SchemaResult{
+			Schema: SchemaInfo{
+				Name:       schema.Name,
+				EntityType: schema.EntityType,
+			},
+			Items: make([]ExtractedItem, 0),
+		}
+
+		timeField := schemaTimeField(schema)
+
+		elements, err := root.QueryAll(schema.SelectorType, schema.Selector)
+		if err != nil {
+			if err := checkContext(ctx, url); err != nil {
+				return err
+			}
+			result.Errors = append(result.Errors, ExtractionError{
+				Field:   schema.Name,
+				Message: fmt.Sprintf("failed to find elements with selector: %s", schema.Selector),
+				URL:     url,
+			})
+			failed = true
+			continue
+		}
+
+		for _, element := range elements {
+			item, errs, err := ev.extractItem(ctx, element, schema, url)
+			if err != nil {
+				return err
+			}
+			if len(errs) > 0 {
+				result.Errors = append(result.Errors, errs...)
+				partial = true
+			}
+			if reason := invalidItemReason(item, schema); reason != "" {
+				result.Errors = append(result.Errors, ExtractionError{
+					Field:   schema.Name,
+					Message: fmt.Sprintf("item dropped: %s", reason),
+					URL:     url,
+				})
+				schemaResult.Dropped++
+				partial = true
+				continue
+			}
+
+			// extract external_id
+			if externalID, ok := generateExternalID(item, config, schema, pageURL); ok {
+				item["external_id"] = externalID
+				delete(item, "_id")
+			}
+
+			// extract external_time
+			externalTime, ok, err := extractExternalTime(item, timeField)
+			if err != nil {
+				result.Errors = append(result.Errors, ExtractionError{
+					Field:   "_time",
+					Message: err.Error(),
+					URL:     url,
+				})
+			}
+			if ok && err == nil {
+				item["external_time"] = externalTime
+				item["external_time_extracted"] = true
+				delete(item, "_time")
+			} else {
+				item["external_time"] = time.Now()
+				item["external_time_extracted"] = false
+			}
+			schemaResult.Items = append(schemaResult.Items, item)
+		}
+
+		if len(schemaResult.Items) < schema.MinItems {
+			result.Errors = append(result.Errors, ExtractionError{
+				Field:   schema.Name,
+				Message: fmt.Sprintf("got %d items, expected at least %d", len(schemaResult.Items), schema.MinItems),
+				URL:     url,
+			})
+			failed = true
+		}
+		total += len(schemaResult.Items)
+		result.SchemaResults[schema.Name] = schemaResult
+	}
+
+	switch {
+	case failed || total == 0:
+		result.Status = StatusFailed
+	case partial:
+		result.Status = StatusPartial
+	default:
+		result.Status = StatusSuccess
+	}
+	return nil
+}
+
+// invalidItemReason returns why item breaks the rules of schema, or an empty
+// string if it is valid.
+func invalidItemReason(item ExtractedItem, schema Schema) string {
+	if len(item) == 0 {
+		return "no field could be extracted"
+	}
+	missing := missingFields(item, schema.Fields, "")
+	for _, name := range schema.RequiredFields {
+		if _, ok := item[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Sprintf("missing required fields: %s", strings.Join(missing, ", "))
+	}
+	return ""
+}
+
+// missingFields returns the required fields missing from item, descending
+// into the objects of nested fields and the entries of list fields. Nested
+// names are qualified by their path, e.g. "author.name" or "offers[1].price".
+func missingFields(item map[string]interface{}, fields []Field, prefix string) []string {
+	var missing []string
+	for _, field := range fields {
+		value, ok := item[field.Name]
+		if !ok {
+			if field.Required {
+				missing = append(missing, prefix+field.Name)
+			}
+			continue
+		}
+		switch value := value.(type) {
+		case ExtractedItem:
+			missing = append(missing, missingFields(value, field.Fields, prefix+field.Name+".")...)
+		case map[string]interface{}:
+			missing = append(missing, missingFields(value, field.Fields, prefix+field.Name+".")...)
+		case []map[string]interface{}:
+			for i, entry := range value {
+				missing = append(missing, missingFields(entry, field.Fields, fmt.Sprintf("%s%s[%d].", prefix, field.Name, i))...)
+			}
+		case []interface{}:
+			for i, entry := range value {
+				if entry, ok := entry.(map[string]interface{}); ok {
+					missing = append(missing, missingFields(entry, field.Fields, fmt.Sprintf("%s%s[%d].", prefix, field.Name, i))...)
+				}
+			}
+		}
+	}
+	return missing
+}
+
+// evaluator extracts field values from nodes. It is shared by the static and
+// browser extractors so that every field type behaves the same in both modes.
+type evaluator struct {
+	config *CompiledConfig
+	// root is the document node; selectors starting with "//" are always
+	// evaluated against it.
+	root node
+	// baseURL is what relative links resolve against, taking <base href>
+	// into account.
+	baseURL *neturl.URL
+	// path holds the names of the schema and fields being extracted, used
+	// as the key of hits.
+	path []string
+	// hits counts the matches of each fallback selector chain.
+	hits map[string][]int
+	// tree caches the document for structured data fields.
+	tree *html.Node
+}
+
+func (ev *evaluator) extractItem(ctx context.Context, element node, schema Schema, url string) (ExtractedItem, []ExtractionError, error) {
+	item := make(ExtractedItem)
+	var errors []ExtractionError
+	ev.path = append(ev.path[:0], schema.Name)
+
+	for _, field := range schema.Fields {
+		if err := checkContext(ctx, url); err != nil {
+			return nil, nil, err
+		}
+		value, err := ev.extractField(element, field)
+		if err != nil {
+			if err := checkContext(ctx, url); err != nil {
+				return nil, nil, err
+			}
+			errors = append(errors, ExtractionError{
+				Field:   field.Name,
+				Message: err.Error(),
+				URL:     url,
+			})
+			continue
+		}
+		item[field.Name] = value
+	}
+
+	return item, errors, nil
+}
+
+// queryOne evaluates selector relative to contextNode. XPath selectors
+// starting with "//" and JSONPath selectors starting with "$" are evaluated
+// against the document; a CSS selector of just ":scope" selects contextNode
+// itself, like the XPath "." and the JSONPath "@".
+func (ev *evaluator) queryOne(selectorType, selector string, contextNode node) (node, error) {
+	if selectorType == SelectorJSONPath && strings.HasPrefix(selector, "$") {
+		return ev.root.QueryOne(selectorType, selector)
+	}
+	if selectorType == SelectorCSS {
+		if selector == ":scope" {
+			return contextNode, nil
+		}
+		return contextNode.QueryOne(selectorType, selector)
+	}
+	if strings.HasPrefix(selector, "//") {
+		return ev.root.QueryOne(selectorType, selector)
+	}
+	return contextNode.QueryOne(selectorType, selector)
+}
+
+func (ev *evaluator) queryAll(selectorType, selector string, contextNode node) ([]node, error) {
+	if selectorType == SelectorJSONPath && strings.HasPrefix(selector, "$") {
+		return ev.root.QueryAll(selectorType, selector)
+	}
+	if selectorType == SelectorCSS {
+		if selector == ":scope" {
+			return []node{contextNode}, nil
+		}
+		return contextNode.QueryAll(selectorType, selector)
+	}
+	if strings.HasPrefix(selector, "//") {
+		return ev.root.QueryAll(selectorType, selector)
+	}
+	return contextNode.QueryAll(selectorType, selector)
+}
+
+func (ev *evaluator) evaluateCount(countXPath string, element node) (int, error) {
+	if !isValidXPath(countXPath) {
+		return 0, fmt.Errorf("invalid XPath expression: %s", countXPath)
+	}
+
+	nodes, err := ev.queryAll(SelectorXPath, countXPath, element)
+	if err != nil {
+		return 0, err
+	}
+	return len(nodes), nil
+}
+
+// processCountExpression replaces every count(...) in selector with the
+// number of nodes the inner XPath matches.
+func (ev *evaluator) processCountExpression(selector string, element node) (string, error) {
+	for strings.Contains(selector, "count(") {
+		start := strings.Index(selector, "count(")
+		if start == -1 {
+			break
+		}
+
+		bracketCount := 1
+		end := start + 6
+		for end < len(selector) && bracketCount > 0 {
+			if selector[end] == '(' {
+				bracketCount++
+			} else if selector[end] == ')' {
+				bracketCount--
+			}
+			end++
+		}
+
+		if bracketCount != 0 {
+			return "", fmt.Errorf("unmatched brackets in count expression")
+		}
+
+		countXPath := selector[start+6 : end-1]
+		count, err := ev.evaluateCount(countXPath, element)
+		if err != nil {
+			return "", err
+		}
+
+		selector = selector[:start] + fmt.Sprintf("%d", count) + selector[end:]
+	}
+	return selector, nil
+}
+
+// findElement resolves the field selector, including count(...) expressions
+// in XPath, to a single node.
+func (ev *evaluator) findElement(selectorType, selector string, element node) (node, error) {
+	if selectorType == SelectorXPath && strings.Contains(selector, "count(") {
+		processedSelector, err := ev.processCountExpression(selector, element)
+		if err != nil {
+			return nil, err
+		}
+		selector = processedSelector
+	}
+
+	el, err := ev.queryOne(selectorType, selector, element)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %s: %v", selector, err)
+	}
+	if el == nil {
+		return nil, fmt.Errorf("element not found for selector: %s", selector)
+	}
+	return el, nil
+}
+
+// fieldSelectors returns the selector chain of field: Selector followed by
+// the fallback Selectors.
+func fieldSelectors(field Field) []string {
+	if field.Selector == "" && len(field.Selectors) > 0 {
+		return field.Selectors
+	}
+	return append([]string{field.Selector}, field.Selectors...)
+}
+
+// selectsSelf reports whether field reads the element it is evaluated on.
+func selectsSelf(field Field) bool {
+	return len(field.Selectors) == 0 && (field.Selector == "." || field.Selector == ":scope" || field.Selector == "@")
+}
+
+func selectorsString(field Field) string {
+	return strings.Join(fieldSelectors(field), " | ")
+}
+
+// findFieldElement resolves the selector chain of field to the first node
+// matched by any of its selectors.
+func (ev *evaluator) findFieldElement(field Field, element node) (node, error) {
+	selectors := fieldSelectors(field)
+	if len(selectors) == 1 {
+		return ev.findElement(field.SelectorType, selectors[0], element)
+	}
+	for i, selector := range selectors {
+		if el, err := ev.findElement(field.SelectorType, selector, element); err == nil {
+			ev.recordHit(len(selectors), i)
+			return el, nil
+		}
+	}
+	ev.recordHit(len(selectors), -1)
+	return nil, fmt.Errorf("element not found for selector: %s", selectorsString(field))
+}
+
+// queryFieldAll returns the nodes matched by the first selector of the chain
+// of field that matches anything.
+func (ev *evaluator) queryFieldAll(field Field, element node) ([]node, error) {
+	selectors := fieldSelectors(field)
+	for i, selector := range selectors {
+		elements, err := ev.queryAll(field.SelectorType, selector, element)
+		if err != nil {
+			if len(selectors) == 1 {
+				return nil, fmt.Errorf("invalid selector %s: %v", selector, err)
+			}
+			continue
+		}
+		if len(elements) > 0 {
+			if len(selectors) > 1 {
+				ev.recordHit(len(selectors), i)
+			}
+			return elements, nil
+		}
+	}
+	if len(selectors) > 1 {
+		ev.recordHit(len(selectors), -1)
+	}
+	return nil, fmt.Errorf("elements not found for selector: %s", selectorsString(field))
+}
+
+// recordHit counts a match of selector index of a chain of n selectors for
+// the current field. An index of -1 records that nothing matched, so that
+// the chain still shows up in the debug output.
+func (ev *evaluator) recordHit(n, index int) {
+	key := strings.Join(ev.path, ".")
+	hits, ok := ev.hits[key]
+	if !ok {
+		hits = make([]int, n)
+		ev.hits[key] = hits
+	}
+	if index >= 0 {
+		hits[index]++
+	}
+}
+
+var blankRunRegexp = regexp.MustCompile(`[ \t]+`)
+
+// normalizeText collapses runs of blanks and drops empty lines.
+func normalizeText(text string) string {
+	text = blankRunRegexp.ReplaceAllString(text, " ")
+	lines := strings.Split(text, "\n")
+	var nonEmptyLines []string
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" {
+			nonEmptyLines = append(nonEmptyLines, trimmed)
+		}
+	}
+	return strings.Join(nonEmptyLines, "\n")
+}
+
+func (ev *evaluator) extractNested(element node, fields []Field) ExtractedItem {
+	nestedItem := make(ExtractedItem)
+	for _, nestedField := range fields {
+		nestedValue, err := ev.extractField(element, nestedField)
+		if err != nil {
+			continue
+		}
+		nestedItem[nestedField.Name] = nestedValue
+	}
+	return nestedItem
+}
+
+// extractField extracts the value of field, runs its transforms and coerces
+// the result to the declared output type. When extraction fails but the
+// field or its pipeline has a default, the pipeline runs on a nil value so
+// that the default can take effect.
+func (ev *evaluator) extractField(element node, field Field) (interface{}, error) {
+	ev.path = append(ev.path, field.Name)
+	defer func() { ev.path = ev.path[:len(ev.path)-1] }()
+
+	value, err := ev.extractValue(element, field)
+	return ev.finishValue(value, err, field)
+}
+
+// finishValue runs the transforms of field on an extracted value, applies
+// its default and coerces the result to the declared output type. err is
+// the extraction error, if any.
+func (ev *evaluator) finishValue(value interface{}, err error, field Field) (interface{}, error) {
+	if err != nil {
+		if field.Default == nil && !hasDefaultTransform(field.Transforms) {
+			return nil, err
+		}
+		value = nil
+	}
+	if len(field.Transforms) > 0 {
+		if value, err = ev.applyTransforms(value, field.Transforms); err != nil {
+			return nil, err
+		}
+	}
+	if field.Default != nil && isEmptyValue(value) {
+		value = field.Default
+	}
+	return ev.coerce(value, field)
+}
+
+func (ev *evaluator) extractValue(element node, field Field) (interface{}, error) {
+	if strings.HasPrefix(field.Name, "_id") || strings.HasPrefix(field.Name, "_time") {
+		if field.Type == "nested" {
+			if nestedItem := ev.extractNested(element, field.Fields); len(nestedItem) > 0 {
+				return nestedItem, nil
+			}
+		}
+
+		switch field.From {
+		case FromURL:
+			re, err := ev.config.regexp(field.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %v", field.Pattern, err)
+			}
+			matches := re.FindStringSubmatch(element.PageURL())
+			if len(matches) > 1 {
+				return strings.Join(matches[1:], "/"), nil
+			}
+			return nil, fmt.Errorf("failed to extract from URL using pattern: %s", field.Pattern)
+		case FromElement:
+			el, err := ev.findFieldElement(field, element)
+			if err != nil {
+				return nil, err
+			}
+			text, err := el.Text()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get text from element: %s", field.Selector)
+			}
+			re, err := ev.config.regexp(field.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %v", field.Pattern, err)
+			}
+			matches := re.FindStringSubmatch(text)
+			if len(matches) > 1 {
+				return strings.Join(matches[1:], "/"), nil
+			}
+			return nil, fmt.Errorf("failed to extract from element using pattern: %s", field.Pattern)
+		default:
+			return nil, fmt.Errorf("unsupported from: %s", field.From)
+		}
+	}
+
+	if field.From == FromNetwork {
+		return ev.networkValue(field)
+	}
+
+	switch field.Type {
+	case "text":
+		el, err := ev.findFieldElement(field, element)
+		if err != nil {
+			return "", err
+		}
+		text, err := el.Text()
+		if err != nil {
+			return "", fmt.Errorf("failed to get text from element: %s", field.Selector)
+		}
+		return normalizeText(text), nil
+
+	case "attribute":
+		if field.Multiple {
+			elements, err := ev.queryFieldAll(field, element)
+			if err != nil {
+				return nil, err
+			}
+			// Elements without the attribute are skipped.
+			var values []interface{}
+			for _, el := range elements {
+				if value, err := ev.attributeValue(el, field); err == nil {
+					values = append(values, value)
+				}
+			}
+			if len(values) == 0 {
+				return nil, fmt.Errorf("attribute %s not found on any element", field.Attribute)
+			}
+			return stringsOrValues(values), nil
+		}
+		el, err := ev.findFieldElement(field, element)
+		if err != nil {
+			return "", err
+		}
+		return ev.attributeValue(el, field)
+
+	case "url":
+		el, err := ev.findFieldElement(field, element)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := el.(*jsonNode); ok && field.Attribute == "" {
+			// JSON strings are URLs themselves.
+			text, err := el.Text()
+			if err != nil {
+				return "", err
+			}
+			return resolveURL(ev.baseURL, text)
+		}
+		attributes := urlAttributes
+		if field.Attribute != "" {
+			attributes = []string{field.Attribute}
+		}
+		for _, attribute := range attributes {
+			value, ok, err := el.Attribute(attribute)
+			if err != nil {
+				return "", fmt.Errorf("failed to get attribute %s: %v", attribute, err)
+			}
+			if ok {
+				return ev.resolveAttribute(attribute, value)
+			}
+		}
+		if _, ok := el.(*xmlNode); ok && field.Attribute == "" {
+			// RSS links are the text of the element.
+			text, err := el.Text()
+			if err != nil {
+				return "", err
+			}
+			if text = strings.TrimSpace(text); text != "" {
+				return resolveURL(ev.baseURL, text)
+			}
+		}
+		return "", fmt.Errorf("attribute %s not found", strings.Join(attributes, " or "))
+
+	case FieldJSONLD, FieldMicrodata, FieldRDFa, FieldOpenGraph:
+		return ev.structuredValue(element, field)
+
+	case FieldJSON:
+		el := element
+		if field.Selector != "" || len(field.Selectors) > 0 {
+			var err error
+			if el, err = ev.findFieldElement(field, element); err != nil {
+				return nil, err
+			}
+		}
+		if jn, ok := el.(*jsonNode); ok {
+			// In json mode the value is already parsed.
+			return ev.selectJSON(jn.value, field)
+		}
+		text, err := el.Text()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get text from element: %s", selectorsString(field))
+		}
+		return ev.jsonValue(text, field)
+
+	case "html", "inner_html", "markdown":
+		el, err := ev.findFieldElement(field, element)
+		if err != nil {
+			return "", err
+		}
+		return ev.markupValue(el, field)
+
+	case FieldTable:
+		el, err := ev.findFieldElement(field, element)
+		if err != nil {
+			return nil, err
+		}
+		return ev.tableValue(el, field)
+
+	case FieldJS:
+		return ev.jsValue(element, field)
+
+	case "nested":
+		nestedElement, err := ev.findFieldElement(field, element)
+		if err != nil {
+			return nil, fmt.Errorf("nested element not found for selector: %s", selectorsString(field))
+		}
+		if nestedItem := ev.extractNested(nestedElement, field.Fields); len(nestedItem) > 0 {
+			return nestedItem, nil
+		}
+		return nil, fmt.Errorf("all nested fields failed to extract")
+
+	case "list":
+		elements, err := ev.queryFieldAll(field, element)
+		if err != nil {
+			return nil, err
+		}
+
+		// Check for single text field case
+		if len(field.Fields) == 1 && field.Fields[0].Type == "text" && selectsSelf(field.Fields[0]) {
+			var items []interface{}
+			for _, el := range elements {
+				value, err := ev.extractField(el, field.Fields[0])
+				if err != nil {
+					continue
+				}
+				items = append(items, value)
+			}
+			return stringsOrValues(items), nil
+		}
+
+		var items []map[string]interface{}
+		for _, el := range elements {
+			item := make(map[string]interface{})
+			for _, subField := range field.Fields {
+				value, err := ev.extractField(el, subField)
+				if err != nil {
+					continue
+				}
+				item[subField.Name] = value
+			}
+			if len(item) > 0 {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported field type: %s", field.Type)
+	}
+}
+
+// attributeValue returns the attribute of el named by the field, or a map
+// of the attributes matching it when it is a glob such as "data-*" or "*".
+func (ev *evaluator) attributeValue(el node, field Field) (interface{}, error) {
+	if !isAttributeGlob(field.Attribute) {
+		value, ok, err := el.Attribute(field.Attribute)
+		if err != nil {
+			return "", fmt.Errorf("failed to get attribute %s: %v", field.Attribute, err)
+		}
+		if !ok {
+			return "", fmt.Errorf("attribute %s not found", field.Attribute)
+		}
+		if field.Resolve {
+			return ev.resolveAttribute(field.Attribute, value)
+		}
+		return value, nil
+	}
+
+	attributes, err := el.Attributes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attributes: %v", err)
+	}
+	result := make(map[string]interface{})
+	for name, value := range attributes {
+		if matched, _ := path.Match(field.Attribute, name); !matched {
+			continue
+		}
+		if field.Resolve && containsString(linkAttributes, strings.ToLower(name)) {
+			if resolved, err := ev.resolveAttribute(name, value); err == nil {
+				value = resolved
+			}
+		}
+		result[name] = value
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no attributes matching %s found", field.Attribute)
+	}
+	return result, nil
+}
+
+// isAttributeGlob reports whether an attribute name is a pattern selecting
+// several attributes.
+func isAttributeGlob(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+func isValidAttributeGlob(name string) bool {
+	_, err := path.Match(name, "")
+	return err == nil
+}
+
+// resolveAttribute turns the value of a link attribute into an absolute,
+// normalised URL. For srcset attributes the largest candidate is used.
+func (ev *evaluator) resolveAttribute(attribute, value string) (string, error) {
+	if strings.HasSuffix(strings.ToLower(attribute), "srcset") {
+		candidate, err := largestSrcsetCandidate(value)
+		if err != nil {
+			return "", err
+		}
+		value = candidate
+	}
+	return resolveURL(ev.baseURL, value)
+}
+
+// stringsOrValues returns values as []string when every value is a string,
+// which is what untransformed text lists have always produced.
+func stringsOrValues(values []interface{}) interface{} {
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		str, ok := value.(string)
+		if !ok {
+			return values
+		}
+		strs = append(strs, str)
+	}
+	return strs
+}
+
+func isValidXPath(xpath string) bool {
+	bracketCount := 0
+	for _, c := range xpath {
+		if c == '(' {
+			bracketCount++
+		} else if c == ')' {
+			bracketCount--
+		}
+		if bracketCount < 0 {
+			return false
+		}
+	}
+	return bracketCount == 0
+}
@@ -4,21 +4,21 @@ go 1.23.1
 
 require (
 	github.com/antchfx/htmlquery v1.3.3
+	github.com/antchfx/xpath v1.3.2
 	github.com/crawlerclub/httpcache v0.0.0-20250227015546-4f8a5bac5c28
 	github.com/go-rod/rod v0.116.2
+	github.com/liuzl/store v0.0.0-20190530065605-e2dbcd3c77fc
+	github.com/microcosm-cc/bluemonday v1.0.27
+	github.com/projectdiscovery/useragent v0.0.93
 	golang.org/x/net v0.35.0
 )
 
 require (
-	github.com/antchfx/xpath v1.3.2 // indirect
 	github.com/aymerick/douceur v0.2.0 // indirect
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	github.com/golang/snappy v0.0.4 // indirect
 	github.com/gorilla/css v1.0.1 // indirect
-	github.com/liuzl/store v0.0.0-20190530065605-e2dbcd3c77fc // indirect
-	github.com/microcosm-cc/bluemonday v1.0.27 // indirect
 	github.com/projectdiscovery/blackrock v0.0.1 // indirect
-	github.com/projectdiscovery/useragent v0.0.93 // indirect
 	github.com/projectdiscovery/utils v0.4.12 // indirect
 	github.com/saintfish/chardet v0.0.0-20230101081208-5e3ef4b5456d // indirect
 	github.com/syndtr/goleveldb v1.0.0 // indirect
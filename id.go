@@ -0,0 +1,215 @@
+package extractor
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"sort"
+	"strings"
+)
+
+// ID strategies for IDConfig.Strategies.
+const (
+	// IDFromPattern joins the captures of the _id fields, the historical
+	// behaviour and the default.
+	IDFromPattern string = "pattern"
+	// IDFromURL hashes the canonical form of the page URL, or of the item
+	// field named by IDConfig.URLField.
+	IDFromURL string = "url_hash"
+	// IDFromFields hashes the values of IDConfig.Fields.
+	IDFromFields string = "fields_hash"
+	// IDFromContent hashes the whole item together with the page URL. It is
+	// always tried last, so every item gets an ID once IDConfig is set.
+	IDFromContent string = "content_hash"
+)
+
+// Namespaces for IDConfig.Namespace.
+const (
+	IDNamespaceName           string = "name"
+	IDNamespaceEntityType     string = "entity_type"
+	IDNamespaceNameEntityType string = "name_entity_type"
+)
+
+// IDConfig declares how external_id is generated for the items of a schema.
+type IDConfig struct {
+	Strategies   []string `json:"strategies,omitempty"`
+	Fields       []string `json:"fields,omitempty"`
+	URLField     string   `json:"url_field,omitempty"`
+	Namespace    string   `json:"namespace,omitempty"`
+	PreserveCase bool     `json:"preserve_case,omitempty"`
+}
+
+// generateExternalID computes the external_id of item. Without an IDConfig
+// only the _id captures are used, upper-cased, and the bool reports whether
+// they were present.
+func generateExternalID(item ExtractedItem, config *CompiledConfig, schema Schema, pageURL string) (string, bool) {
+	idConfig := schema.ID
+	if idConfig == nil {
+		externalID, ok := extractExternalID(item)
+		return strings.ToUpper(externalID), ok
+	}
+
+	strategies := append([]string{}, idConfig.Strategies...)
+	if len(strategies) == 0 {
+		strategies = append(strategies, IDFromPattern)
+	}
+	strategies = append(strategies, IDFromContent)
+
+	var id string
+	for _, strategy := range strategies {
+		var ok bool
+		switch strategy {
+		case IDFromPattern:
+			id, ok = extractExternalID(item)
+			ok = ok && id != ""
+		case IDFromURL:
+			id, ok = urlHashID(item, idConfig.URLField, pageURL)
+		case IDFromFields:
+			id, ok = fieldsHashID(item, idConfig.Fields)
+		case IDFromContent:
+			id, ok = contentHashID(item, pageURL), true
+		}
+		if ok {
+			break
+		}
+	}
+
+	if !idConfig.PreserveCase {
+		id = strings.ToUpper(id)
+	}
+
+	var namespace []string
+	switch idConfig.Namespace {
+	case IDNamespaceName:
+		namespace = []string{config.Name}
+	case IDNamespaceEntityType:
+		namespace = []string{schema.EntityType}
+	case IDNamespaceNameEntityType:
+		namespace = []string{config.Name, schema.EntityType}
+	}
+	if len(namespace) > 0 {
+		id = strings.Join(append(namespace, id), ":")
+	}
+	return id, true
+}
+
+func extractExternalID(item map[string]interface{}) (string, bool) {
+	idItem, ok := item["_id"]
+	if !ok {
+		return "", false
+	}
+
+	switch idValue := idItem.(type) {
+	case string:
+		return idValue, true
+
+	case ExtractedItem:
+		type idField struct {
+			FieldK string
+			FieldV string
+		}
+		idFields := []idField{}
+		for idk, idv := range idValue {
+			if !strings.HasPrefix(idk, "_id") {
+				continue
+			}
+			if fieldV, ok := idv.(string); ok {
+				idFields = append(idFields, idField{
+					FieldK: idk,
+					FieldV: fieldV,
+				})
+			}
+		}
+		sort.Slice(idFields, func(i, j int) bool {
+			return idFields[i].FieldK < idFields[j].FieldK
+		})
+		idParts := []string{}
+		for _, idField := range idFields {
+			idParts = append(idParts, idField.FieldV)
+		}
+		return strings.Join(idParts, "_"), true
+	}
+
+	return "", false
+}
+
+func urlHashID(item ExtractedItem, urlField, pageURL string) (string, bool) {
+	rawURL := pageURL
+	if urlField != "" {
+		value, ok := item[urlField].(string)
+		if !ok || value == "" {
+			return "", false
+		}
+		rawURL = value
+	}
+	canonical, err := canonicalURL(rawURL)
+	if err != nil {
+		return "", false
+	}
+	return hashString(canonical), true
+}
+
+func fieldsHashID(item ExtractedItem, fields []string) (string, bool) {
+	parts := make([]string, 0, len(fields))
+	for _, name := range fields {
+		value, ok := item[name]
+		if !ok {
+			return "", false
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", false
+		}
+		parts = append(parts, string(data))
+	}
+	return hashString(strings.Join(parts, "\x1f")), true
+}
+
+func contentHashID(item ExtractedItem, pageURL string) string {
+	content := make(map[string]interface{}, len(item))
+	for k, v := range item {
+		if strings.HasPrefix(k, "_") || strings.HasPrefix(k, "external_") {
+			continue
+		}
+		content[k] = v
+	}
+	// json.Marshal sorts map keys, so the encoding is stable.
+	data, err := json.Marshal(content)
+	if err != nil {
+		data = []byte(fmt.Sprint(content))
+	}
+	return hashString(pageURL + "\x1f" + string(data))
+}
+
+func hashString(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalURL normalises rawURL so that trivially different spellings of
+// the same page hash to the same ID: the scheme and host are lower-cased,
+// default ports, fragments and utm_* parameters are dropped and the query is
+// sorted.
+func canonicalURL(rawURL string) (string, error) {
+	u, err := neturl.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+	normalizeHost(u)
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(strings.ToLower(key), "utm_") {
+			query.Del(key)
+		}
+	}
+	// Encode sorts by key.
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,95 @@
+package extractor
+
+import "testing"
+
+func TestGenerateExternalID(t *testing.T) {
+	const pageURL = "https://example.com/list"
+	item := ExtractedItem{
+		"title":       "T",
+		"price":       3,
+		"link":        "HTTPS://Example.com:443/items/7#reviews",
+		"_id":         ExtractedItem{"_id_2": "b", "_id_1": "a", "other": "x"},
+		"external_id": "ignored",
+	}
+	// sha1 of the canonical link, the fields and the content.
+	const (
+		linkHash    = "2ec8f735bc25e6e3eb2d258730b89e13beb41556"
+		fieldsHash  = "f2062128120a67441988f5d1b1a74360d8b6ade7"
+		contentHash = "86e6b81aac9fb40fd7797a6d22f129ad38193e06"
+		itemHash    = "8893d84f0dd05b9214d95ec3d5d71c1410d7882f"
+	)
+	tests := []struct {
+		name    string
+		item    ExtractedItem
+		id      *IDConfig
+		pageURL string
+		want    string
+		wantOK  bool
+	}{
+		{name: "no config, captures", item: item, want: "A_B", wantOK: true},
+		{name: "no config, string", item: ExtractedItem{"_id": "abc"}, want: "ABC", wantOK: true},
+		{name: "no config, missing", item: ExtractedItem{"title": "T"}, want: "", wantOK: false},
+		{name: "pattern", item: item, id: &IDConfig{}, want: "A_B", wantOK: true},
+		{name: "pattern preserving case", item: item, id: &IDConfig{PreserveCase: true}, want: "a_b", wantOK: true},
+		{name: "empty pattern falls back to content", item: ExtractedItem{"_id": "", "title": "T", "price": 3}, id: &IDConfig{PreserveCase: true}, want: contentHash, wantOK: true},
+		{name: "page url hash", item: item, id: &IDConfig{Strategies: []string{IDFromURL}, PreserveCase: true},
+			pageURL: "HTTPS://EXAMPLE.com:443/a?utm_source=x&b=2&a=1#top", want: "c0f0ab3a284a86da37a7545f6bcf95b5cca931a2", wantOK: true},
+		{name: "field url hash", item: item, id: &IDConfig{Strategies: []string{IDFromURL}, URLField: "link", PreserveCase: true}, want: linkHash, wantOK: true},
+		{name: "url hash upper-cased", item: item, id: &IDConfig{Strategies: []string{IDFromURL}, URLField: "link"}, want: "2EC8F735BC25E6E3EB2D258730B89E13BEB41556", wantOK: true},
+		{name: "missing url field falls back to content", item: item, id: &IDConfig{Strategies: []string{IDFromURL}, URLField: "url", PreserveCase: true}, want: itemHash, wantOK: true},
+		{name: "fields hash", item: item, id: &IDConfig{Strategies: []string{IDFromFields}, Fields: []string{"title", "price"}, PreserveCase: true}, want: fieldsHash, wantOK: true},
+		{name: "strategies in order", item: ExtractedItem{"title": "T", "price": 3, "link": item["link"]},
+			id: &IDConfig{Strategies: []string{IDFromPattern, IDFromFields, IDFromURL}, Fields: []string{"title", "price"}, URLField: "link", PreserveCase: true}, want: fieldsHash, wantOK: true},
+		{name: "content hash", item: ExtractedItem{"title": "T", "price": 3, "_id_extra": "x", "external_time": "y"},
+			id: &IDConfig{Strategies: []string{IDFromContent}, PreserveCase: true}, want: contentHash, wantOK: true},
+		{name: "name namespace", item: item, id: &IDConfig{Namespace: IDNamespaceName}, want: "shop:A_B", wantOK: true},
+		{name: "entity type namespace", item: item, id: &IDConfig{Namespace: IDNamespaceEntityType}, want: "product:A_B", wantOK: true},
+		{name: "name and entity type namespace", item: item, id: &IDConfig{Namespace: IDNamespaceNameEntityType, PreserveCase: true}, want: "shop:product:a_b", wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &CompiledConfig{ExtractorConfig: ExtractorConfig{Name: "shop"}}
+			schema := Schema{Name: "products", EntityType: "product", ID: tt.id}
+			url := tt.pageURL
+			if url == "" {
+				url = pageURL
+			}
+			got, ok := generateExternalID(tt.item, config, schema, url)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("generateExternalID = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCanonicalURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/a", "https://example.com/a"},
+		{"HTTPS://Example.COM/Path", "https://example.com/Path"},
+		{"http://example.com:80/a", "http://example.com/a"},
+		{"https://example.com:443", "https://example.com/"},
+		{"http://example.com:443/a", "http://example.com:443/a"},
+		{"https://example.com:8443/a", "https://example.com:8443/a"},
+		{"https://example.com/a#section", "https://example.com/a"},
+		{"https://example.com/a?b=2&a=1", "https://example.com/a?a=1&b=2"},
+		{"https://example.com/a?utm_source=x&UTM_Medium=y&id=3", "https://example.com/a?id=3"},
+		{"  https://example.com/a  ", "https://example.com/a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := canonicalURL(tt.url)
+			if err != nil {
+				t.Fatalf("canonicalURL(%q) failed: %v", tt.url, err)
+			}
+			if got != tt.want {
+				t.Errorf("canonicalURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+	if got, err := canonicalURL("http://[::1"); err == nil {
+		t.Errorf("canonicalURL accepted an invalid URL: %q", got)
+	}
+}
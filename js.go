@@ -0,0 +1,61 @@
+package extractor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// FieldJS is the field type for values computed by JavaScript in browser
+// mode.
+const FieldJS string = "js"
+
+// scriptTimeout bounds the evaluation of a js field.
+const scriptTimeout = 10 * time.Second
+
+// scriptFunction wraps the script of a js field. The element is bound to
+// this and to el; a script that evaluates to a function is called with the
+// element, so that statements can be wrapped in an arrow function.
+const scriptFunction = `function(el) { const value = (%s); return typeof value === "function" ? value.call(this, el) : value }`
+
+// jsValue evaluates the script of field in the browser on the element
+// matched by its selector, or on element itself without one, and returns
+// the result decoded from JSON. Promises are awaited.
+func (ev *evaluator) jsValue(element node, field Field) (interface{}, error) {
+	el := element
+	if field.Selector != "" || len(field.Selectors) > 0 {
+		var err error
+		if el, err = ev.findFieldElement(field, element); err != nil {
+			return nil, err
+		}
+	}
+	rn, ok := el.(*rodNode)
+	if !ok {
+		return nil, fmt.Errorf("js fields are only evaluated in browser mode")
+	}
+	obj, err := rn.evalScript(field.Script)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate script: %v", err)
+	}
+	if obj.Type == proto.RuntimeRemoteObjectTypeUndefined {
+		return nil, fmt.Errorf("script returned undefined: %s", field.Script)
+	}
+	var value interface{}
+	if err := obj.Value.Unmarshal(&value); err != nil {
+		return nil, fmt.Errorf("failed to decode script result: %v", err)
+	}
+	return ev.selectJSON(value, field)
+}
+
+func (r *rodNode) evalScript(script string) (*proto.RuntimeRemoteObject, error) {
+	el, err := r.element()
+	if err != nil {
+		return nil, err
+	}
+	el = el.Timeout(scriptTimeout)
+	defer el.CancelTimeout()
+	js := fmt.Sprintf(scriptFunction, strings.Trim(script, " \t\r\n;"))
+	return el.Eval(js, el.Object)
+}
@@ -0,0 +1,128 @@
+package extractor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// JSONExtractor extracts items from JSON responses such as API endpoints.
+// Selectors are JSONPath expressions over the decoded body.
+type JSONExtractor struct {
+	Config ExtractorConfig
+
+	compiled   *CompiledConfig
+	compileErr error
+}
+
+func NewJSONExtractor(config ExtractorConfig) *JSONExtractor {
+	if config.Mode == "" {
+		config.Mode = ModeJSON
+	}
+	compiled, err := CompileConfig(config)
+	return &JSONExtractor{Config: config, compiled: compiled, compileErr: err}
+}
+
+func (e *JSONExtractor) ExtractWithoutCache(url string) (*ExtractionResult, error) {
+	return e.extract(context.Background(), url, false)
+}
+
+func (e *JSONExtractor) Extract(url string) (*ExtractionResult, error) {
+	return e.extract(context.Background(), url, true)
+}
+
+func (e *JSONExtractor) ExtractWithoutCacheContext(ctx context.Context, url string) (*ExtractionResult, error) {
+	return e.extract(ctx, url, false)
+}
+
+func (e *JSONExtractor) ExtractContext(ctx context.Context, url string) (*ExtractionResult, error) {
+	return e.extract(ctx, url, true)
+}
+
+func (e *JSONExtractor) extract(ctx context.Context, url string, cache bool) (*ExtractionResult, error) {
+	if e.compileErr != nil {
+		return nil, e.compileErr
+	}
+	client, err := getPageCache()
+	if err != nil {
+		return nil, err
+	}
+	content, finalURL, err := client.fetch(ctx, url, cache)
+	if err != nil {
+		if _, ok := err.(*TimeoutError); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+
+	value, err := decodeJSON(content)
+	if err != nil {
+		client.forget(url)
+		return nil, err
+	}
+
+	result, err := e.extractValue(ctx, value, url, finalURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Do not keep broken responses in the cache.
+	if result.Status == StatusFailed {
+		client.forget(url)
+	}
+
+	return result, nil
+}
+
+// ExtractJSON runs the config against an already fetched response. baseURL
+// is the logical URL of the response and is what the _id and _time URL
+// patterns see.
+func (e *JSONExtractor) ExtractJSON(content []byte, baseURL string) (*ExtractionResult, error) {
+	if e.compileErr != nil {
+		return nil, e.compileErr
+	}
+	value, err := decodeJSON(content)
+	if err != nil {
+		return nil, err
+	}
+	return e.extractValue(context.Background(), value, baseURL, baseURL)
+}
+
+// ExtractReader is like ExtractJSON but reads the response from r.
+func (e *JSONExtractor) ExtractReader(r io.Reader, baseURL string) (*ExtractionResult, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JSON: %v", err)
+	}
+	return e.ExtractJSON(content, baseURL)
+}
+
+func (e *JSONExtractor) extractValue(ctx context.Context, value interface{}, url, finalURL string) (*ExtractionResult, error) {
+	result := &ExtractionResult{
+		SchemaResults: make(map[string]SchemaResult),
+		Errors:        make([]ExtractionError, 0),
+		FinalURL:      finalURL,
+		Mode:          ModeJSON,
+	}
+
+	if err := extractSchemas(ctx, e.compiled, newJSONNode(value, finalURL, e.compiled), url, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// decodeJSON decodes a response body. Bodies that are not strict JSON, such
+// as JSONP callbacks, are parsed leniently.
+func decodeJSON(content []byte) (interface{}, error) {
+	var value interface{}
+	err := json.Unmarshal(bytes.TrimSpace(content), &value)
+	if err == nil {
+		return value, nil
+	}
+	if lenient, lenientErr := parseLenientJSON(string(content)); lenientErr == nil {
+		return lenient, nil
+	}
+	return nil, fmt.Errorf("failed to parse JSON: %v", err)
+}
@@ -0,0 +1,657 @@
+package extractor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a compiled JSONPath expression over values decoded by
+// encoding/json. It supports:
+//
+//	$.store.book[0].title   child names and array indexes
+//	@.title                 the same as $, for paths relative to an item
+//	store.book.0.title      the same without $, gjson style
+//	$['store']['book']      bracket notation, also with several names
+//	$.book[*] / $.book.*    wildcards
+//	$..author               recursive descent
+//	$.book[-1] / [1:3]      negative indexes and slices
+//	$.book[?(@.price < 10 && @.isbn)]
+//	                        filters with ==, !=, <, <=, >, >=, =~ and !
+type jsonPath struct {
+	expr  string
+	steps []jsonStep
+}
+
+// jsonStep maps one value to the values it selects.
+type jsonStep func(value interface{}) []interface{}
+
+// compileJSONPath parses expr. An empty expression, "$" or "@" selects the
+// value itself.
+func compileJSONPath(expr string) (*jsonPath, error) {
+	p := &jsonPathParser{s: strings.TrimSpace(expr)}
+	if !p.eof() && (p.peek() == '$' || p.peek() == '@') {
+		p.pos++
+	} else if !p.eof() && p.peek() != '.' && p.peek() != '[' {
+		// gjson style paths start with a bare name.
+		step, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		p.steps = append(p.steps, step)
+	}
+	if err := p.parseSteps(); err != nil {
+		return nil, err
+	}
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", p.peek())
+	}
+	return &jsonPath{expr: expr, steps: p.steps}, nil
+}
+
+// Evaluate returns every value selected from root, in document order.
+func (p *jsonPath) Evaluate(root interface{}) []interface{} {
+	values := []interface{}{root}
+	for _, step := range p.steps {
+		var next []interface{}
+		for _, value := range values {
+			next = append(next, step(value)...)
+		}
+		values = next
+	}
+	return values
+}
+
+func (p *jsonPath) String() string {
+	return p.expr
+}
+
+type jsonPathParser struct {
+	s     string
+	pos   int
+	steps []jsonStep
+}
+
+func (p *jsonPathParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *jsonPathParser) peek() byte {
+	return p.s[p.pos]
+}
+
+func (p *jsonPathParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid JSONPath at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *jsonPathParser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// parseSteps parses segments until something that is not a segment follows.
+func (p *jsonPathParser) parseSteps() error {
+	for !p.eof() {
+		var step jsonStep
+		var err error
+		switch {
+		case strings.HasPrefix(p.s[p.pos:], ".."):
+			p.pos += 2
+			if !p.eof() && p.peek() == '[' {
+				step, err = p.parseBracket()
+			} else {
+				step, err = p.parseName()
+			}
+			if err == nil {
+				step = recursiveStep(step)
+			}
+		case p.peek() == '.':
+			p.pos++
+			step, err = p.parseName()
+		case p.peek() == '[':
+			step, err = p.parseBracket()
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p.steps = append(p.steps, step)
+	}
+	return nil
+}
+
+// parseName parses a dotted segment: a name, * or, gjson style, an index.
+func (p *jsonPathParser) parseName() (jsonStep, error) {
+	start := p.pos
+	for !p.eof() && strings.IndexByte(".[]()=!<>&|, \t", p.peek()) < 0 {
+		p.pos++
+	}
+	name := p.s[start:p.pos]
+	if name == "" {
+		return nil, p.errorf("name expected")
+	}
+	if name == "*" {
+		return wildcardStep, nil
+	}
+	if index, err := strconv.Atoi(name); err == nil {
+		return func(value interface{}) []interface{} {
+			if arr, ok := value.([]interface{}); ok {
+				return indexStep(index)(arr)
+			}
+			return keyStep(name)(value)
+		}, nil
+	}
+	return keyStep(name), nil
+}
+
+func (p *jsonPathParser) parseBracket() (jsonStep, error) {
+	p.pos++
+	p.skipSpace()
+	if p.eof() {
+		return nil, p.errorf("] expected")
+	}
+
+	var step jsonStep
+	switch c := p.peek(); {
+	case c == '*':
+		p.pos++
+		step = wildcardStep
+	case c == '?':
+		p.pos++
+		p.skipSpace()
+		if p.eof() || p.peek() != '(' {
+			return nil, p.errorf("( expected")
+		}
+		p.pos++
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.eof() || p.peek() != ')' {
+			return nil, p.errorf(") expected")
+		}
+		p.pos++
+		step = filterStep(filter)
+	case c == '\'' || c == '"':
+		var keys []string
+		for {
+			key, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+			p.skipSpace()
+			if p.eof() || p.peek() != ',' {
+				break
+			}
+			p.pos++
+			p.skipSpace()
+			if p.eof() || (p.peek() != '\'' && p.peek() != '"') {
+				return nil, p.errorf("name expected")
+			}
+		}
+		step = func(value interface{}) []interface{} {
+			var result []interface{}
+			for _, key := range keys {
+				result = append(result, keyStep(key)(value)...)
+			}
+			return result
+		}
+	default:
+		var err error
+		if step, err = p.parseIndexes(); err != nil {
+			return nil, err
+		}
+	}
+
+	p.skipSpace()
+	if p.eof() || p.peek() != ']' {
+		return nil, p.errorf("] expected")
+	}
+	p.pos++
+	return step, nil
+}
+
+// parseIndexes parses an index, a list of indexes or a slice.
+func (p *jsonPathParser) parseIndexes() (jsonStep, error) {
+	start := p.pos
+	for !p.eof() && p.peek() != ']' {
+		p.pos++
+	}
+	spec := strings.ReplaceAll(p.s[start:p.pos], " ", "")
+
+	if strings.Contains(spec, ":") {
+		parts := strings.Split(spec, ":")
+		if len(parts) > 3 {
+			return nil, p.errorf("invalid slice %q", spec)
+		}
+		bounds := make([]*int, 3)
+		for i, part := range parts {
+			if part == "" {
+				continue
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, p.errorf("invalid slice %q", spec)
+			}
+			bounds[i] = &n
+		}
+		return sliceStep(bounds[0], bounds[1], bounds[2]), nil
+	}
+
+	var indexes []int
+	for _, part := range strings.Split(spec, ",") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, p.errorf("invalid index %q", part)
+		}
+		indexes = append(indexes, n)
+	}
+	return func(value interface{}) []interface{} {
+		var result []interface{}
+		for _, index := range indexes {
+			result = append(result, indexStep(index)(value)...)
+		}
+		return result
+	}, nil
+}
+
+func (p *jsonPathParser) parseString() (string, error) {
+	if p.eof() {
+		return "", p.errorf("string expected")
+	}
+	quote := p.peek()
+	p.pos++
+	var sb strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		p.pos++
+		switch c {
+		case quote:
+			return sb.String(), nil
+		case '\\':
+			if p.eof() {
+				return "", p.errorf("unfinished escape")
+			}
+			sb.WriteByte(p.peek())
+			p.pos++
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// jsonFilter evaluates a filter expression for the current value @.
+type jsonFilter func(current interface{}) bool
+
+func (p *jsonPathParser) parseOr() (jsonFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !strings.HasPrefix(p.s[p.pos:], "||") {
+			return left, nil
+		}
+		p.pos += 2
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(current interface{}) bool { return l(current) || right(current) }
+	}
+}
+
+func (p *jsonPathParser) parseAnd() (jsonFilter, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !strings.HasPrefix(p.s[p.pos:], "&&") {
+			return left, nil
+		}
+		p.pos += 2
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(current interface{}) bool { return l(current) && right(current) }
+	}
+}
+
+// jsonOperand returns the value of one side of a comparison and whether it
+// exists.
+type jsonOperand func(current interface{}) (interface{}, bool)
+
+func (p *jsonPathParser) parseComparison() (jsonFilter, error) {
+	p.skipSpace()
+	if !p.eof() && p.peek() == '!' {
+		p.pos++
+		inner, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		return func(current interface{}) bool { return !inner(current) }, nil
+	}
+	if !p.eof() && p.peek() == '(' {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.eof() || p.peek() != ')' {
+			return nil, p.errorf(") expected")
+		}
+		p.pos++
+		return inner, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	op := ""
+	for _, candidate := range []string{"==", "!=", "<=", ">=", "=~", "<", ">"} {
+		if strings.HasPrefix(p.s[p.pos:], candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return func(current interface{}) bool {
+			_, ok := left(current)
+			return ok
+		}, nil
+	}
+	p.pos += len(op)
+	p.skipSpace()
+
+	if op == "=~" {
+		if p.eof() || p.peek() != '/' {
+			return nil, p.errorf("regular expression expected")
+		}
+		end := p.pos + 1
+		for end < len(p.s) && p.s[end] != '/' {
+			if p.s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(p.s) {
+			return nil, p.errorf("unterminated regular expression")
+		}
+		pattern := p.s[p.pos+1 : end]
+		p.pos = end + 1
+		flags := ""
+		if !p.eof() && p.peek() == 'i' {
+			flags = "(?i)"
+			p.pos++
+		}
+		re, err := regexp.Compile(flags + pattern)
+		if err != nil {
+			return nil, p.errorf("invalid regular expression: %v", err)
+		}
+		return func(current interface{}) bool {
+			value, ok := left(current)
+			s, isString := value.(string)
+			return ok && isString && re.MatchString(s)
+		}, nil
+	}
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return func(current interface{}) bool {
+		l, ok := left(current)
+		if !ok {
+			return false
+		}
+		r, ok := right(current)
+		if !ok {
+			return false
+		}
+		return compareJSON(l, r, op)
+	}, nil
+}
+
+func (p *jsonPathParser) parseOperand() (jsonOperand, error) {
+	if p.eof() {
+		return nil, p.errorf("operand expected")
+	}
+	switch c := p.peek(); {
+	case c == '@' || c == '$':
+		p.pos++
+		sub := &jsonPathParser{s: p.s, pos: p.pos}
+		if err := sub.parseSteps(); err != nil {
+			return nil, err
+		}
+		p.pos = sub.pos
+		path := &jsonPath{steps: sub.steps}
+		return func(current interface{}) (interface{}, bool) {
+			values := path.Evaluate(current)
+			if len(values) == 0 {
+				return nil, false
+			}
+			return values[0], true
+		}, nil
+	case c == '\'' || c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return constOperand(s), nil
+	}
+
+	start := p.pos
+	for !p.eof() && strings.IndexByte(" \t)=!<>&|", p.peek()) < 0 {
+		p.pos++
+	}
+	literal := p.s[start:p.pos]
+	switch literal {
+	case "true":
+		return constOperand(true), nil
+	case "false":
+		return constOperand(false), nil
+	case "null":
+		return constOperand(nil), nil
+	}
+	f, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		return nil, p.errorf("invalid literal %q", literal)
+	}
+	return constOperand(f), nil
+}
+
+func constOperand(value interface{}) jsonOperand {
+	return func(interface{}) (interface{}, bool) { return value, true }
+}
+
+// compareJSON compares decoded JSON values. Numbers and strings are ordered;
+// other values only support equality.
+func compareJSON(l, r interface{}, op string) bool {
+	if lf, ok := toFloat(l); ok {
+		if rf, ok := toFloat(r); ok {
+			switch op {
+			case "==":
+				return lf == rf
+			case "!=":
+				return lf != rf
+			case "<":
+				return lf < rf
+			case "<=":
+				return lf <= rf
+			case ">":
+				return lf > rf
+			case ">=":
+				return lf >= rf
+			}
+		}
+	}
+	if ls, ok := l.(string); ok {
+		if rs, ok := r.(string); ok {
+			switch op {
+			case "==":
+				return ls == rs
+			case "!=":
+				return ls != rs
+			case "<":
+				return ls < rs
+			case "<=":
+				return ls <= rs
+			case ">":
+				return ls > rs
+			case ">=":
+				return ls >= rs
+			}
+		}
+	}
+	switch op {
+	case "==":
+		return fmt.Sprint(l) == fmt.Sprint(r)
+	case "!=":
+		return fmt.Sprint(l) != fmt.Sprint(r)
+	}
+	return false
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func keyStep(key string) jsonStep {
+	return func(value interface{}) []interface{} {
+		if obj, ok := value.(map[string]interface{}); ok {
+			if child, ok := obj[key]; ok {
+				return []interface{}{child}
+			}
+		}
+		return nil
+	}
+}
+
+func indexStep(index int) jsonStep {
+	return func(value interface{}) []interface{} {
+		arr, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		i := index
+		if i < 0 {
+			i += len(arr)
+		}
+		if i < 0 || i >= len(arr) {
+			return nil
+		}
+		return []interface{}{arr[i]}
+	}
+}
+
+func sliceStep(start, end, step *int) jsonStep {
+	return func(value interface{}) []interface{} {
+		arr, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		n := len(arr)
+		bound := func(b *int, def int) int {
+			if b == nil {
+				return def
+			}
+			i := *b
+			if i < 0 {
+				i += n
+			}
+			if i < 0 {
+				return 0
+			}
+			if i > n {
+				return n
+			}
+			return i
+		}
+		stride := 1
+		if step != nil && *step > 0 {
+			stride = *step
+		}
+		var result []interface{}
+		for i := bound(start, 0); i < bound(end, n); i += stride {
+			result = append(result, arr[i])
+		}
+		return result
+	}
+}
+
+// jsonChildren returns the elements of an array or the values of an object,
+// the latter sorted by key so that results are stable.
+func jsonChildren(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		children := make([]interface{}, len(keys))
+		for i, key := range keys {
+			children[i] = v[key]
+		}
+		return children
+	}
+	return nil
+}
+
+func wildcardStep(value interface{}) []interface{} {
+	return jsonChildren(value)
+}
+
+func filterStep(filter jsonFilter) jsonStep {
+	return func(value interface{}) []interface{} {
+		var result []interface{}
+		for _, child := range jsonChildren(value) {
+			if filter(child) {
+				result = append(result, child)
+			}
+		}
+		return result
+	}
+}
+
+// recursiveStep applies step to the value and all of its descendants.
+func recursiveStep(step jsonStep) jsonStep {
+	return func(value interface{}) []interface{} {
+		var result []interface{}
+		var walk func(v interface{})
+		walk = func(v interface{}) {
+			result = append(result, step(v)...)
+			for _, child := range jsonChildren(v) {
+				walk(child)
+			}
+		}
+		walk(value)
+		return result
+	}
+}
@@ -0,0 +1,149 @@
+package extractor
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const jsonPathFixture = `{
+  "store": {
+    "name": "Books and Co",
+    "book": [
+      {"title": "Sayings", "author": "Rees", "price": 8.95, "category": "reference"},
+      {"title": "Sword", "author": "Waugh", "price": 12.99, "category": "fiction"},
+      {"title": "Moby Dick", "author": "Melville", "price": 8.99, "isbn": "0-553", "category": "fiction"},
+      {"title": "The Lord", "author": "Tolkien", "price": 22.99, "isbn": "0-395", "category": "fiction"}
+    ],
+    "bicycle": {"color": "red", "price": 19.95}
+  },
+  "odd key": {"a.b": 1, "it's": 2},
+  "flags": [true, false, null]
+}`
+
+var jsonPathTests = []struct {
+	expr string
+	want string
+}{
+	{"", `[` + jsonPathFixtureCompact + `]`},
+	{"$", `[` + jsonPathFixtureCompact + `]`},
+	{"$.store.name", `["Books and Co"]`},
+	{"@.store.bicycle.color", `["red"]`},
+	{"store.book.0.title", `["Sayings"]`},
+	{"$.store.book[0].title", `["Sayings"]`},
+	{"$.store.book[-1].title", `["The Lord"]`},
+	{"$.store.book[9].title", `null`},
+	{"$.store.book[0,2].author", `["Rees","Melville"]`},
+	{"$.store.book[1:3].author", `["Waugh","Melville"]`},
+	{"$.store.book[:2].author", `["Rees","Waugh"]`},
+	{"$.store.book[-2:].author", `["Melville","Tolkien"]`},
+	{"$.store.book[::2].author", `["Rees","Melville"]`},
+	{"$.store.book[*].price", `[8.95,12.99,8.99,22.99]`},
+	{"$.store.book.*.category", `["reference","fiction","fiction","fiction"]`},
+	{"$['store']['bicycle']['color']", `["red"]`},
+	{`$["store"].bicycle["color", 'price']`, `["red",19.95]`},
+	{`$['odd key']['a.b']`, `[1]`},
+	{`$['odd key']['it\'s']`, `[2]`},
+	{"$..author", `["Rees","Waugh","Melville","Tolkien"]`},
+	{"$..book[1].title", `["Sword"]`},
+	{"$.store..price", `[19.95,8.95,12.99,8.99,22.99]`},
+	{"$.store.book[?(@.isbn)].title", `["Moby Dick","The Lord"]`},
+	{"$.store.book[?(!@.isbn)].title", `["Sayings","Sword"]`},
+	{"$.store.book[?(@.price < 10)].title", `["Sayings","Moby Dick"]`},
+	{"$.store.book[?(@.price >= 12.99)].title", `["Sword","The Lord"]`},
+	{"$.store.book[?(@.category == 'fiction' && @.price < 20)].title", `["Sword","Moby Dick"]`},
+	{`$.store.book[?(@.author == "Rees" || @.author == "Tolkien")].title`, `["Sayings","The Lord"]`},
+	{"$.store.book[?(@.category != 'fiction')].title", `["Sayings"]`},
+	{"$.store.book[?((@.price < 9 || @.price > 20) && @.isbn)].title", `["Moby Dick","The Lord"]`},
+	{"$.store.book[?(@.title =~ /^the/i)].author", `["Tolkien"]`},
+	{"$.flags[?(@ == true)]", `[true]`},
+	{"$.flags[?(@ == null)]", `[null]`},
+	{"$.missing", `null`},
+	{"$.store.name.length", `null`},
+}
+
+var jsonPathFixtureCompact = func() string {
+	var value interface{}
+	if err := json.Unmarshal([]byte(jsonPathFixture), &value); err != nil {
+		panic(err)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}()
+
+func TestJSONPathEvaluate(t *testing.T) {
+	var root interface{}
+	if err := json.Unmarshal([]byte(jsonPathFixture), &root); err != nil {
+		t.Fatalf("failed to decode fixture: %v", err)
+	}
+	for _, tt := range jsonPathTests {
+		t.Run(tt.expr, func(t *testing.T) {
+			path, err := compileJSONPath(tt.expr)
+			if err != nil {
+				t.Fatalf("compileJSONPath(%q) failed: %v", tt.expr, err)
+			}
+			got, err := json.Marshal(path.Evaluate(root))
+			if err != nil {
+				t.Fatalf("failed to encode result: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Evaluate(%q) = %s, want %s", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileJSONPathErrors(t *testing.T) {
+	for _, expr := range []string{
+		"$.",
+		"$..",
+		"$[",
+		"$[]",
+		"$['a'",
+		"$['a',",
+		"$['a', ",
+		"$['a',]",
+		"$['a', 1]",
+		"$['a",
+		`$['a\`,
+		"$[0",
+		"$[a]",
+		"$[1:2:3:4]",
+		"$[1:x]",
+		"$[?",
+		"$[?(",
+		"$[?(@.a",
+		"$[?(@.a ==",
+		"$[?(@.a == )]",
+		"$[?(@.a == 'x",
+		"$[?(@.a =~ x)]",
+		"$[?(@.a =~ /x)]",
+		"$[?(@.a =~ /(/)]",
+		"$[?(@.a && )]",
+		"$[?((@.a)]",
+		"$[?(@.a == 1x)]",
+		"$.a b",
+		"$)",
+	} {
+		if _, err := compileJSONPath(expr); err == nil {
+			t.Errorf("compileJSONPath(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+// TestCompileJSONPathTruncated checks that every prefix of the supported
+// expressions compiles or fails with an error, but never panics.
+func TestCompileJSONPathTruncated(t *testing.T) {
+	for _, tt := range jsonPathTests {
+		for i := range tt.expr {
+			expr := tt.expr[:i]
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("compileJSONPath(%q) panicked: %v", expr, r)
+					}
+				}()
+				_, _ = compileJSONPath(expr)
+			}()
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package extractor
+
+import "strings"
+
+// JSONSchemaDraft is the JSON Schema dialect produced by JSONSchema.
+const JSONSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema describes the items produced by config as a JSON Schema. Each
+// schema of the config becomes a definition under $defs, and the top level
+// object maps schema names to arrays of those items.
+func JSONSchema(config ExtractorConfig) map[string]interface{} {
+	config = applyPreset(config)
+	defs := make(map[string]interface{})
+	properties := make(map[string]interface{})
+	for _, schema := range config.Schemas {
+		defs[schema.Name] = itemJSONSchema(schema)
+		properties[schema.Name] = map[string]interface{}{
+			"type":  "array",
+			"items": map[string]interface{}{"$ref": "#/$defs/" + schema.Name},
+		}
+	}
+	return map[string]interface{}{
+		"$schema":    JSONSchemaDraft,
+		"title":      config.Name,
+		"type":       "object",
+		"properties": properties,
+		"$defs":      defs,
+	}
+}
+
+func itemJSONSchema(schema Schema) map[string]interface{} {
+	properties := fieldsJSONSchema(schema.Fields)
+	required := requiredFields(schema.Fields)
+	for _, name := range schema.RequiredFields {
+		if !containsString(required, name) && !strings.HasPrefix(name, "_id") && !strings.HasPrefix(name, "_time") {
+			required = append(required, name)
+		}
+	}
+
+	hasID := schema.ID != nil
+	for _, field := range schema.Fields {
+		if strings.HasPrefix(field.Name, "_id") {
+			hasID = true
+		}
+	}
+	if hasID {
+		properties["external_id"] = map[string]interface{}{"type": "string"}
+	}
+	if schema.ID != nil {
+		required = append(required, "external_id")
+	}
+	properties["external_time"] = map[string]interface{}{"type": "string", "format": "date-time"}
+	properties["external_time_extracted"] = map[string]interface{}{"type": "boolean"}
+	required = append(required, "external_time", "external_time_extracted")
+
+	result := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+	if schema.EntityType != "" {
+		result["title"] = schema.EntityType
+	}
+	return result
+}
+
+// fieldsJSONSchema returns the properties produced by fields. _id and _time
+// fields are folded into external_id and external_time and are skipped.
+func fieldsJSONSchema(fields []Field) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for _, field := range fields {
+		if strings.HasPrefix(field.Name, "_id") || strings.HasPrefix(field.Name, "_time") {
+			continue
+		}
+		properties[field.Name] = fieldJSONSchema(field)
+	}
+	return properties
+}
+
+func requiredFields(fields []Field) []string {
+	required := []string{}
+	for _, field := range fields {
+		if field.Required && !strings.HasPrefix(field.Name, "_id") && !strings.HasPrefix(field.Name, "_time") {
+			required = append(required, field.Name)
+		}
+	}
+	return required
+}
+
+func containsString(list []string, s string) bool {
+	for _, elem := range list {
+		if elem == s {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldJSONSchema(field Field) map[string]interface{} {
+	if field.OutputType != "" {
+		if s := outputJSONSchema(field); s != nil {
+			return s
+		}
+	}
+	if s := transformsJSONSchema(field.Transforms); s != nil {
+		return s
+	}
+
+	switch field.Type {
+	case "url":
+		return map[string]interface{}{"type": "string", "format": "uri"}
+	case "attribute":
+		value := map[string]interface{}{"type": "string"}
+		if isAttributeGlob(field.Attribute) {
+			value = map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": map[string]interface{}{"type": "string"},
+			}
+		} else if field.Resolve {
+			value["format"] = "uri"
+		}
+		if field.Multiple {
+			return map[string]interface{}{"type": "array", "items": value}
+		}
+		return value
+	case FieldJSON, FieldJS:
+		value := map[string]interface{}{}
+		if len(field.Fields) > 0 {
+			value = map[string]interface{}{
+				"type":       "object",
+				"properties": fieldsJSONSchema(field.Fields),
+			}
+		}
+		if field.Multiple {
+			return map[string]interface{}{"type": "array", "items": value}
+		}
+		return value
+	case FieldJSONLD, FieldMicrodata, FieldRDFa, FieldOpenGraph:
+		value := map[string]interface{}{}
+		if field.Path == "" {
+			value["type"] = "object"
+		}
+		if field.Multiple {
+			return map[string]interface{}{"type": "array", "items": value}
+		}
+		return value
+	case FieldTable:
+		row := map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": map[string]interface{}{"type": "string"},
+		}
+		if len(field.Headers) > 0 {
+			properties := make(map[string]interface{})
+			for _, header := range field.Headers {
+				properties[header] = map[string]interface{}{"type": "string"}
+			}
+			row["properties"] = properties
+		}
+		switch field.TableFormat {
+		case TableRows:
+			return map[string]interface{}{"type": "array", "items": row}
+		case TableMap:
+			return map[string]interface{}{"type": "object"}
+		}
+		return map[string]interface{}{"anyOf": []interface{}{
+			map[string]interface{}{"type": "array", "items": row},
+			map[string]interface{}{"type": "object"},
+		}}
+	case "nested":
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": fieldsJSONSchema(field.Fields),
+			"required":   requiredFields(field.Fields),
+		}
+	case "list":
+		return map[string]interface{}{"type": "array", "items": listItemJSONSchema(field)}
+	}
+	return map[string]interface{}{"type": "string"}
+}
+
+func listItemJSONSchema(field Field) map[string]interface{} {
+	if len(field.Fields) == 1 && field.Fields[0].Type == "text" && selectsSelf(field.Fields[0]) {
+		return fieldJSONSchema(field.Fields[0])
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": fieldsJSONSchema(field.Fields),
+		"required":   requiredFields(field.Fields),
+	}
+}
+
+func outputJSONSchema(field Field) map[string]interface{} {
+	switch field.OutputType {
+	case OutputString:
+		return map[string]interface{}{"type": "string"}
+	case OutputInt:
+		return map[string]interface{}{"type": "integer"}
+	case OutputFloat:
+		return map[string]interface{}{"type": "number"}
+	case OutputBool:
+		return map[string]interface{}{"type": "boolean"}
+	case OutputDatetime:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case OutputURL:
+		return map[string]interface{}{"type": "string", "format": "uri"}
+	case OutputArray:
+		if field.Type == "list" {
+			return map[string]interface{}{"type": "array", "items": listItemJSONSchema(field)}
+		}
+		return map[string]interface{}{"type": "array"}
+	case OutputObject:
+		if field.Type == "nested" {
+			return map[string]interface{}{
+				"type":       "object",
+				"properties": fieldsJSONSchema(field.Fields),
+				"required":   requiredFields(field.Fields),
+			}
+		}
+		return map[string]interface{}{"type": "object"}
+	}
+	return nil
+}
+
+// transformsJSONSchema infers the output type from the transforms that
+// change the type of the value, if any.
+func transformsJSONSchema(transforms []Transform) map[string]interface{} {
+	var elem map[string]interface{}
+	array := false
+	for _, t := range transforms {
+		switch t.Type {
+		case TransformToInt:
+			elem = map[string]interface{}{"type": "integer"}
+		case TransformToFloat:
+			elem = map[string]interface{}{"type": "number"}
+		case TransformToBool:
+			elem = map[string]interface{}{"type": "boolean"}
+		case TransformSplit:
+			array = true
+			elem = map[string]interface{}{"type": "string"}
+		case TransformJoin:
+			array = false
+			elem = map[string]interface{}{"type": "string"}
+		}
+	}
+	if elem == nil {
+		return nil
+	}
+	if array {
+		return map[string]interface{}{"type": "array", "items": elem}
+	}
+	return elem
+}
@@ -0,0 +1,502 @@
+package extractor
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// parseLenientJSON parses the first JSON value or JavaScript object literal
+// in s. Script state such as `window.__STATE__ = {...};` is accepted as is:
+// text before the first object or array and anything after the value are
+// ignored. Besides JSON it understands unquoted and single-quoted keys,
+// single-quoted and template strings without substitutions, trailing commas,
+// comments, hex numbers, undefined, NaN and Infinity (all decoded as null),
+// !0 and !1, and JSON.parse("...") around a string, which is also looked for
+// when skipping to the value. Numbers are float64 and
+// objects map[string]interface{}, like encoding/json.
+func parseLenientJSON(s string) (interface{}, error) {
+	p := &jsParser{s: s}
+	p.skipSpace()
+	if p.eof() {
+		return nil, fmt.Errorf("no JSON value found")
+	}
+	if !p.atValue() {
+		start := strings.IndexAny(s, "{[")
+		if i := strings.Index(s, "JSON.parse("); i >= 0 && (start < 0 || i < start) {
+			start = i
+		}
+		if start < 0 {
+			return nil, fmt.Errorf("no JSON object or array found")
+		}
+		p.pos = start
+	}
+	return p.parseValue()
+}
+
+type jsParser struct {
+	s   string
+	pos int
+}
+
+func (p *jsParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *jsParser) peek() byte {
+	return p.s[p.pos]
+}
+
+func (p *jsParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid JSON at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// atValue reports whether a value starts at the current position.
+func (p *jsParser) atValue() bool {
+	c := p.peek()
+	if strings.IndexByte("{[\"'`-+.!0123456789", c) >= 0 {
+		return true
+	}
+	for _, word := range []string{"true", "false", "null", "undefined", "NaN", "Infinity", "JSON.parse("} {
+		if strings.HasPrefix(p.s[p.pos:], word) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipSpace skips whitespace and comments.
+func (p *jsParser) skipSpace() {
+	for !p.eof() {
+		switch {
+		case strings.IndexByte(" \t\n\r\f\v", p.peek()) >= 0:
+			p.pos++
+		case strings.HasPrefix(p.s[p.pos:], "//"):
+			end := strings.IndexByte(p.s[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.s)
+			} else {
+				p.pos += end + 1
+			}
+		case strings.HasPrefix(p.s[p.pos:], "/*"):
+			end := strings.Index(p.s[p.pos+2:], "*/")
+			if end < 0 {
+				p.pos = len(p.s)
+			} else {
+				p.pos += end + 4
+			}
+		default:
+			if strings.HasPrefix(p.s[p.pos:], "\u00a0") || strings.HasPrefix(p.s[p.pos:], "\ufeff") {
+				_, size := utf8.DecodeRuneInString(p.s[p.pos:])
+				p.pos += size
+				continue
+			}
+			return
+		}
+	}
+}
+
+func (p *jsParser) parseValue() (interface{}, error) {
+	p.skipSpace()
+	if p.eof() {
+		return nil, p.errorf("value expected")
+	}
+	switch c := p.peek(); {
+	case c == '{':
+		return p.parseObject()
+	case c == '[':
+		return p.parseArray()
+	case c == '"' || c == '\'' || c == '`':
+		return p.parseString()
+	case c == '!':
+		p.pos++
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return !truthy(value), nil
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	}
+
+	word := p.parseIdentifier()
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null", "undefined", "NaN", "Infinity":
+		return nil, nil
+	case "JSON.parse":
+		return p.parseJSONParse()
+	case "":
+		return nil, p.errorf("unexpected %q", p.peek())
+	}
+	return nil, p.errorf("unsupported identifier %s", word)
+}
+
+// parseJSONParse parses the argument of JSON.parse("..."), a string that
+// holds JSON itself.
+func (p *jsParser) parseJSONParse() (interface{}, error) {
+	p.skipSpace()
+	if p.eof() || p.peek() != '(' {
+		return nil, p.errorf("( expected")
+	}
+	p.pos++
+	p.skipSpace()
+	if p.eof() || strings.IndexByte("\"'`", p.peek()) < 0 {
+		return nil, p.errorf("string expected in JSON.parse")
+	}
+	inner, err := p.parseString()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.eof() || p.peek() != ')' {
+		return nil, p.errorf(") expected")
+	}
+	p.pos++
+	value, err := (&jsParser{s: inner}).parseValue()
+	if err != nil {
+		return nil, fmt.Errorf("in JSON.parse: %v", err)
+	}
+	return value, nil
+}
+
+func (p *jsParser) parseObject() (interface{}, error) {
+	p.pos++
+	obj := make(map[string]interface{})
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf("unterminated object")
+		}
+		if p.peek() == '}' {
+			p.pos++
+			return obj, nil
+		}
+
+		var key string
+		switch c := p.peek(); {
+		case c == '"' || c == '\'' || c == '`':
+			var err error
+			if key, err = p.parseString(); err != nil {
+				return nil, err
+			}
+		case c >= '0' && c <= '9':
+			start := p.pos
+			if _, err := p.parseNumber(); err != nil {
+				return nil, err
+			}
+			key = p.s[start:p.pos]
+		default:
+			if key = p.parseIdentifier(); key == "" {
+				return nil, p.errorf("object key expected, got %q", c)
+			}
+		}
+
+		p.skipSpace()
+		if p.eof() || p.peek() != ':' {
+			return nil, p.errorf(": expected after key %q", key)
+		}
+		p.pos++
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		obj[key] = value
+
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf("unterminated object")
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+		default:
+			return nil, p.errorf(", or } expected")
+		}
+	}
+}
+
+func (p *jsParser) parseArray() (interface{}, error) {
+	p.pos++
+	arr := make([]interface{}, 0)
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return arr, nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, value)
+
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf(", or ] expected")
+		}
+	}
+}
+
+// parseIdentifier parses a JavaScript identifier, allowing dots so that
+// JSON.parse is read as one word.
+func (p *jsParser) parseIdentifier() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if c == '_' || c == '$' || c == '.' || c >= 0x80 ||
+			(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9' && p.pos > start) {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *jsParser) parseNumber() (interface{}, error) {
+	start := p.pos
+	if c := p.peek(); c == '-' || c == '+' {
+		p.pos++
+	}
+	if strings.HasPrefix(p.s[p.pos:], "Infinity") {
+		p.pos += len("Infinity")
+		return nil, nil
+	}
+	if strings.HasPrefix(p.s[p.pos:], "0x") || strings.HasPrefix(p.s[p.pos:], "0X") {
+		p.pos += 2
+		digits := p.pos
+		for !p.eof() && isHexDigit(p.peek()) {
+			p.pos++
+		}
+		n, err := strconv.ParseUint(p.s[digits:p.pos], 16, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", p.s[start:p.pos])
+		}
+		if p.s[start] == '-' {
+			return -float64(n), nil
+		}
+		return float64(n), nil
+	}
+	for !p.eof() && strings.IndexByte("0123456789.eE+-_", p.peek()) >= 0 {
+		if (p.peek() == '+' || p.peek() == '-') && p.s[p.pos-1] != 'e' && p.s[p.pos-1] != 'E' {
+			break
+		}
+		p.pos++
+	}
+	text := strings.ReplaceAll(p.s[start:p.pos], "_", "")
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsInf(f, 0) {
+		return nil, p.errorf("invalid number %q", text)
+	}
+	return f, nil
+}
+
+func (p *jsParser) parseString() (string, error) {
+	quote := p.peek()
+	p.pos++
+	var sb strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		switch {
+		case c == quote:
+			p.pos++
+			return sb.String(), nil
+		case c == '$' && quote == '`' && strings.HasPrefix(p.s[p.pos:], "${"):
+			return "", p.errorf("template substitutions are not supported")
+		case c == '\\':
+			p.pos++
+			if p.eof() {
+				return "", p.errorf("unterminated string")
+			}
+			if err := p.parseStringEscape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *jsParser) parseStringEscape(sb *strings.Builder) error {
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'n':
+		sb.WriteByte('\n')
+	case 't':
+		sb.WriteByte('\t')
+	case 'r':
+		sb.WriteByte('\r')
+	case 'b':
+		sb.WriteByte('\b')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'v':
+		sb.WriteByte('\v')
+	case '0':
+		sb.WriteByte(0)
+	case '\n':
+		// Line continuation.
+	case '\r':
+		if !p.eof() && p.peek() == '\n' {
+			p.pos++
+		}
+	case 'x':
+		if p.pos+2 > len(p.s) {
+			return p.errorf("invalid \\x escape")
+		}
+		n, err := strconv.ParseUint(p.s[p.pos:p.pos+2], 16, 8)
+		if err != nil {
+			return p.errorf("invalid \\x escape")
+		}
+		sb.WriteRune(rune(n))
+		p.pos += 2
+	case 'u':
+		r, err := p.parseUnicodeEscape()
+		if err != nil {
+			return err
+		}
+		if utf16.IsSurrogate(r) && strings.HasPrefix(p.s[p.pos:], "\\u") {
+			save := p.pos
+			p.pos += 2
+			low, err := p.parseUnicodeEscape()
+			if err == nil && utf16.DecodeRune(r, low) != utf8.RuneError {
+				r = utf16.DecodeRune(r, low)
+			} else {
+				p.pos = save
+			}
+		}
+		sb.WriteRune(r)
+	default:
+		// \", \', \\, \/ and any other escaped character stand for
+		// themselves.
+		p.pos--
+		r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+		sb.WriteRune(r)
+		p.pos += size
+	}
+	return nil
+}
+
+// parseUnicodeEscape parses the part of \uXXXX or \u{X...} after the u.
+func (p *jsParser) parseUnicodeEscape() (rune, error) {
+	if !p.eof() && p.peek() == '{' {
+		end := strings.IndexByte(p.s[p.pos:], '}')
+		if end < 0 {
+			return 0, p.errorf("invalid \\u escape")
+		}
+		n, err := strconv.ParseUint(p.s[p.pos+1:p.pos+end], 16, 32)
+		if err != nil || n > utf8.MaxRune {
+			return 0, p.errorf("invalid \\u escape")
+		}
+		p.pos += end + 1
+		return rune(n), nil
+	}
+	if p.pos+4 > len(p.s) {
+		return 0, p.errorf("invalid \\u escape")
+	}
+	n, err := strconv.ParseUint(p.s[p.pos:p.pos+4], 16, 16)
+	if err != nil {
+		return 0, p.errorf("invalid \\u escape")
+	}
+	p.pos += 4
+	return rune(n), nil
+}
+
+// truthy follows JavaScript truthiness for the values the parser produces.
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+// FieldJSON is the field type for JSON embedded in the page.
+const FieldJSON string = "json"
+
+// jsonValue parses the JSON in text, cut by the field pattern if there is
+// one, and selects from it with selectJSON.
+func (ev *evaluator) jsonValue(text string, field Field) (interface{}, error) {
+	if field.Pattern != "" {
+		re, err := ev.config.regexp(field.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %v", field.Pattern, err)
+		}
+		matches := re.FindStringSubmatch(text)
+		if matches == nil {
+			return nil, fmt.Errorf("pattern %s does not match", field.Pattern)
+		}
+		text = matches[0]
+		if len(matches) > 1 {
+			text = matches[1]
+		}
+	}
+	value, err := parseLenientJSON(text)
+	if err != nil {
+		return nil, err
+	}
+	return ev.selectJSON(value, field)
+}
+
+// selectJSON evaluates the path of field on value. When field has
+// sub-fields, every selected value is turned into an object of the
+// sub-fields, each evaluated relative to it. Without Multiple only the first
+// selected value is returned.
+func (ev *evaluator) selectJSON(value interface{}, field Field) (interface{}, error) {
+	values := []interface{}{value}
+	if field.Path != "" {
+		path, err := ev.config.jsonPath(field.Path)
+		if err != nil {
+			return nil, err
+		}
+		values = path.Evaluate(value)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no value found at path %s", field.Path)
+	}
+
+	if len(field.Fields) > 0 {
+		for i, v := range values {
+			obj := make(map[string]interface{})
+			for _, subField := range field.Fields {
+				subValue, err := ev.selectJSON(v, subField)
+				if subValue, err = ev.finishValue(subValue, err, subField); err == nil {
+					obj[subField.Name] = subValue
+				}
+			}
+			values[i] = obj
+		}
+	}
+
+	if field.Multiple {
+		return values, nil
+	}
+	return values[0], nil
+}
@@ -0,0 +1,111 @@
+package extractor
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var lenientJSONTests = []struct {
+	name  string
+	input string
+	want  string
+}{
+	{"json object", `{"a": 1, "b": [true, false, null], "c": "x"}`, `{"a":1,"b":[true,false,null],"c":"x"}`},
+	{"json array", ` [1, 2.5, -3e2] `, `[1,2.5,-300]`},
+	{"scalar", `"text"`, `"text"`},
+	{"number", `42`, `42`},
+	{"unquoted keys", `{a: 1, $b: 2, _c: 3, d1: 4}`, `{"$b":2,"_c":3,"a":1,"d1":4}`},
+	{"numeric keys", `{1: "one", 2: "two"}`, `{"1":"one","2":"two"}`},
+	{"single quotes", `{'a': 'it\'s', "b": 'say "hi"'}`, `{"a":"it's","b":"say \"hi\""}`},
+	{"template string", "{a: `multi\nline`}", `{"a":"multi\nline"}`},
+	{"trailing commas", `{a: [1, 2,], b: 3,}`, `{"a":[1,2],"b":3}`},
+	{"comments", "{/* block */ a: 1, // line\n b: 2}", `{"a":1,"b":2}`},
+	{"hex numbers", `[0x1F, -0x10]`, `[31,-16]`},
+	{"numeric separators", `[1_000, .5, +2]`, `[1000,0.5,2]`},
+	{"undefined and NaN", `[undefined, NaN, Infinity, -Infinity]`, `[null,null,null,null]`},
+	{"negations", `{a: !0, b: !1, c: !!"x"}`, `{"a":true,"b":false,"c":true}`},
+	{"escapes", `"\x41B\u{43}\n\t\/\q"`, `"ABC\n\t/q"`},
+	{"surrogate pair", `"\ud83d\ude00"`, `"😀"`},
+	{"line continuation", "'a\\\nb'", `"ab"`},
+	{"script assignment", `window.__STATE__ = {"page": {"id": 7}};`, `{"page":{"id":7}}`},
+	{"script with trailing code", `var data = [1, 2]; init(data);`, `[1,2]`},
+	{"json parse", `window.__DATA__ = JSON.parse("{\"a\":[1,2]}");`, `{"a":[1,2]}`},
+	{"json parse with single quotes", `JSON.parse('{"a":"b"}')`, `{"a":"b"}`},
+	{"bom and nbsp", "\ufeff\u00a0{a: 1}", `{"a":1}`},
+	{"nested", `{a: {b: {c: [{d: 'e'}]}}}`, `{"a":{"b":{"c":[{"d":"e"}]}}}`},
+}
+
+func TestParseLenientJSON(t *testing.T) {
+	for _, tt := range lenientJSONTests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := parseLenientJSON(tt.input)
+			if err != nil {
+				t.Fatalf("parseLenientJSON(%q) failed: %v", tt.input, err)
+			}
+			got, err := json.Marshal(value)
+			if err != nil {
+				t.Fatalf("failed to encode result: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("parseLenientJSON(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLenientJSONErrors(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"   ",
+		"// only a comment",
+		"var x = 1 +",
+		"{",
+		"[1, 2",
+		`{"a" 1}`,
+		`{"a": }`,
+		`{"a": 1 "b": 2}`,
+		`[1 2]`,
+		`{a: foo}`,
+		`{: 1}`,
+		`"unterminated`,
+		`'unterminated\`,
+		"`${x}`",
+		`"\x4"`,
+		`"\u12"`,
+		`"\u{110000}"`,
+		`"\u{41"`,
+		`[0x]`,
+		`[1e]`,
+		`[-]`,
+		`[1e400]`,
+		`JSON.parse(x)`,
+		`JSON.parse("{")`,
+		`JSON.parse("{}"`,
+		`!`,
+	} {
+		if value, err := parseLenientJSON(input); err == nil {
+			t.Errorf("parseLenientJSON(%q) = %v, want an error", input, value)
+		}
+	}
+}
+
+// TestParseLenientJSONTruncated checks that every prefix of the objects and
+// arrays above is parsed or rejected with an error, but never panics.
+func TestParseLenientJSONTruncated(t *testing.T) {
+	for _, tt := range lenientJSONTests {
+		if tt.want[0] != '{' && tt.want[0] != '[' {
+			continue
+		}
+		for i := 0; i < len(tt.input); i++ {
+			input := tt.input[:i]
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("parseLenientJSON(%q) panicked: %v", input, r)
+					}
+				}()
+				_, _ = parseLenientJSON(input)
+			}()
+		}
+	}
+}
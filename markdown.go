@@ -0,0 +1,305 @@
+package extractor
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// markdownSkipped are elements whose content never shows up in Markdown.
+var markdownSkipped = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"head": true, "iframe": true, "object": true, "svg": true,
+	"button": true, "select": true, "textarea": true,
+}
+
+// markdownBlocks are elements that start a new block.
+var markdownBlocks = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"body": true, "dd": true, "details": true, "div": true, "dl": true,
+	"dt": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "header": true, "hr": true,
+	"html": true, "li": true, "main": true, "nav": true, "ol": true,
+	"p": true, "pre": true, "section": true, "summary": true, "table": true,
+	"ul": true,
+}
+
+// toMarkdown converts the subtree of n, including n itself, to Markdown.
+func toMarkdown(n *html.Node) string {
+	if n.Type == html.DocumentNode {
+		return strings.Join(markdownBlocksOf(n.FirstChild), "\n\n")
+	}
+	return strings.Join(markdownBlocksOf(n), "\n\n")
+}
+
+// markdownBlocksOf converts first and its following siblings to Markdown
+// blocks. Inline content between blocks is gathered into paragraphs.
+func markdownBlocksOf(first *html.Node) []string {
+	var blocks []string
+	var inline strings.Builder
+	flush := func() {
+		if paragraph := markdownParagraph(inline.String()); paragraph != "" {
+			blocks = append(blocks, paragraph)
+		}
+		inline.Reset()
+	}
+
+	for n := first; n != nil; n = n.NextSibling {
+		if n.Type == html.ElementNode && markdownSkipped[n.Data] {
+			continue
+		}
+		if n.Type != html.ElementNode || !markdownBlocks[n.Data] {
+			inline.WriteString(markdownInline(n))
+			continue
+		}
+		flush()
+		if block := markdownBlock(n); block != "" {
+			blocks = append(blocks, block)
+		}
+	}
+	flush()
+	return blocks
+}
+
+func markdownBlock(n *html.Node) string {
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		text := markdownParagraph(markdownInlineChildren(n))
+		if text == "" {
+			return ""
+		}
+		return strings.Repeat("#", int(n.Data[1]-'0')) + " " + strings.ReplaceAll(text, "  \n", " ")
+
+	case "hr":
+		return "---"
+
+	case "pre":
+		language := ""
+		if code := n.FirstChild; code != nil && code == n.LastChild && code.Type == html.ElementNode && code.Data == "code" {
+			class, _ := nodeAttribute(code, "class")
+			for _, c := range strings.Fields(class) {
+				if strings.HasPrefix(c, "language-") {
+					language = strings.TrimPrefix(c, "language-")
+				}
+			}
+		}
+		return "```" + language + "\n" + strings.TrimRight(textContent(n), "\n") + "\n```"
+
+	case "blockquote":
+		inner := strings.Join(markdownBlocksOf(n.FirstChild), "\n\n")
+		if inner == "" {
+			return ""
+		}
+		return prefixLines(inner, "> ", "> ")
+
+	case "ul", "ol":
+		var items []string
+		number := 1
+		for li := n.FirstChild; li != nil; li = li.NextSibling {
+			if li.Type != html.ElementNode || li.Data != "li" {
+				continue
+			}
+			marker := "- "
+			if n.Data == "ol" {
+				marker = fmt.Sprintf("%d. ", number)
+				number++
+			}
+			content := strings.Join(markdownBlocksOf(li.FirstChild), "\n")
+			items = append(items, prefixLines(content, marker, strings.Repeat(" ", len(marker))))
+		}
+		return strings.Join(items, "\n")
+
+	case "table":
+		return markdownTable(n)
+
+	case "li", "dt", "dd":
+		return strings.Join(markdownBlocksOf(n.FirstChild), "\n\n")
+
+	default:
+		return strings.Join(markdownBlocksOf(n.FirstChild), "\n\n")
+	}
+}
+
+// markdownTable renders a table as a pipe table whose first row is the
+// header.
+func markdownTable(table *html.Node) string {
+	var rows [][]string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.Data {
+			case "thead", "tbody", "tfoot":
+				walk(c)
+			case "tr":
+				var row []string
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+						text := strings.ReplaceAll(markdownParagraph(markdownInlineChildren(cell)), "  \n", " ")
+						row = append(row, strings.ReplaceAll(text, "|", `\|`))
+					}
+				}
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			}
+		}
+	}
+	walk(table)
+	if len(rows) == 0 {
+		return ""
+	}
+
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	lines := make([]string, 0, len(rows)+1)
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", columns))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func markdownInlineChildren(n *html.Node) string {
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(markdownInline(c))
+	}
+	return sb.String()
+}
+
+// markdownInline converts inline content. Whitespace is collapsed later by
+// markdownParagraph; hard line breaks are kept as "\n".
+func markdownInline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return escapeMarkdown(strings.Join(strings.Fields(n.Data), " "), n.Data)
+	case html.ElementNode:
+	default:
+		return ""
+	}
+	if markdownSkipped[n.Data] {
+		return ""
+	}
+
+	switch n.Data {
+	case "br":
+		return "\n"
+	case "img":
+		src, _ := nodeAttribute(n, "src")
+		if src == "" {
+			return ""
+		}
+		alt, _ := nodeAttribute(n, "alt")
+		return fmt.Sprintf("![%s](%s)", escapeMarkdown(alt, alt), src)
+	case "code", "kbd", "samp":
+		text := strings.Join(strings.Fields(textContent(n)), " ")
+		if text == "" {
+			return ""
+		}
+		return "`" + text + "`"
+	}
+
+	inner := markdownInlineChildren(n)
+	if markdownBlocks[n.Data] {
+		// Blocks nested in inline content, e.g. a <div> inside a link.
+		return " " + inner + " "
+	}
+	trimmed := strings.TrimSpace(inner)
+	if trimmed == "" {
+		return inner
+	}
+	// Keep the surrounding spaces outside of the markers.
+	lead := inner[:strings.Index(inner, trimmed)]
+	trail := inner[len(lead)+len(trimmed):]
+	switch n.Data {
+	case "strong", "b":
+		return lead + "**" + trimmed + "**" + trail
+	case "em", "i":
+		return lead + "_" + trimmed + "_" + trail
+	case "del", "s", "strike":
+		return lead + "~~" + trimmed + "~~" + trail
+	case "a":
+		href, ok := nodeAttribute(n, "href")
+		if !ok || href == "" || strings.HasPrefix(href, "javascript:") {
+			return inner
+		}
+		return lead + "[" + trimmed + "](" + href + ")" + trail
+	}
+	return inner
+}
+
+// markdownParagraph collapses whitespace in inline Markdown and turns line
+// breaks into hard breaks.
+func markdownParagraph(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "  \n")
+}
+
+// escapeMarkdown escapes the characters of text that Markdown would treat as
+// markup. raw is the original text, whose leading and trailing whitespace is
+// kept as a single space so words of adjacent nodes stay apart.
+func escapeMarkdown(text, raw string) string {
+	var sb strings.Builder
+	if raw != "" && strings.TrimLeft(raw, " \t\n\r\f") != raw && text != "" {
+		sb.WriteByte(' ')
+	}
+	for _, r := range text {
+		switch r {
+		case '\\', '*', '_', '`', '[', ']':
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	if raw != "" && strings.TrimRight(raw, " \t\n\r\f") != raw {
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(textContent(c))
+	}
+	return sb.String()
+}
+
+// prefixLines prefixes the first line of s with first and the other lines
+// with rest.
+func prefixLines(s, first, rest string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		prefix := rest
+		if i == 0 {
+			prefix = first
+		}
+		if line == "" {
+			lines[i] = strings.TrimRight(prefix, " ")
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
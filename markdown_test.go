@@ -0,0 +1,47 @@
+package extractor
+
+import "testing"
+
+func TestToMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"paragraphs", `<div><p>One
+			two</p><p>Three</p></div>`, "One two\n\nThree"},
+		{"headings", `<div><h1>Title</h1><h3>Sub <em>title</em></h3><p>Body</p></div>`, "# Title\n\n### Sub _title_\n\nBody"},
+		{"empty heading", `<div><h2> </h2><p>Body</p></div>`, "Body"},
+		{"unordered list", `<ul><li>One</li><li>Two</li></ul>`, "- One\n- Two"},
+		{"ordered list", `<ol><li>One</li><li>Two</li></ol>`, "1. One\n2. Two"},
+		{"nested list", `<ul><li>One<ul><li>Inner</li></ul></li><li>Two</li></ul>`, "- One\n  - Inner\n- Two"},
+		{"list item paragraphs", `<ol><li><p>First</p><p>More</p></li></ol>`, "1. First\n   More"},
+		{"links", `<p>See <a href="/docs">the docs</a> and <a href="other.html"> this </a>.</p>`, "See [the docs](/docs) and [this](other.html) ."},
+		{"link without href", `<p><a name="x">anchor</a> <a href="javascript:void(0)">js</a></p>`, "anchor js"},
+		{"image", `<p><img src="/a.png" alt="An [image]"></p>`, `![An \[image\]](/a.png)`},
+		{"nested inline formatting", `<p><strong>bold <em>and italic</em></strong> <del>gone</del> <b><i>both</i></b></p>`, "**bold _and italic_** ~~gone~~ **_both_**"},
+		{"formatting keeps spaces outside markers", `<p>a<b> b </b>c</p>`, "a **b** c"},
+		{"inline code", `<p>Run <code>go  test</code> now</p>`, "Run `go test` now"},
+		{"code block", "<pre><code class=\"language-go\">func main() {\n\tfmt.Println(\"*\")\n}\n</code></pre>", "```go\nfunc main() {\n\tfmt.Println(\"*\")\n}\n```"},
+		{"code block without language", "<pre>a  b\n c</pre>", "```\na  b\n c\n```"},
+		{"blockquote", `<blockquote><p>One</p><p>Two</p></blockquote>`, "> One\n>\n> Two"},
+		{"line breaks", `<p>One<br>Two</p>`, "One  \nTwo"},
+		{"horizontal rule", `<div><p>A</p><hr><p>B</p></div>`, "A\n\n---\n\nB"},
+		{"table", `<table><tr><th>Name</th><th>Note</th></tr><tr><td>a|b</td></tr></table>`, "| Name | Note |\n| --- | --- |\n| a\\|b |  |"},
+		{"escaping", `<p>2*3 = [x]_y_ \ ` + "`c`" + `</p>`, "2\\*3 = \\[x\\]\\_y\\_ \\\\ \\`c\\`"},
+		{"skipped elements", `<div><script>x()</script><style>p{}</style><p>Text</p><button>Click</button></div>`, "Text"},
+		{"inline content between blocks", `<div>Lead <b>in</b><p>Block</p>tail</div>`, "Lead **in**\n\nBlock\n\ntail"},
+		{"block inside link", `<span><a href="/x"><div>Card</div></a></span>`, "[Card](/x)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := parseOuterHTML(tt.html)
+			if err != nil {
+				t.Fatalf("parseOuterHTML failed: %v", err)
+			}
+			if got := toMarkdown(n); got != tt.want {
+				t.Errorf("toMarkdown(%q) = %q, want %q", tt.html, got, tt.want)
+			}
+		})
+	}
+}
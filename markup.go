@@ -0,0 +1,190 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// linkAttributes are rewritten when html, inner_html and markdown fields
+// resolve links.
+var linkAttributes = []string{"href", "src", "srcset", "poster"}
+
+// sanitizePolicy keeps the tags and attributes that are safe to display from
+// untrusted HTML: formatting, links, images, lists and tables.
+var sanitizePolicy = bluemonday.UGCPolicy()
+
+// cloneNode returns a detached deep copy of n.
+func cloneNode(n *html.Node) *html.Node {
+	c := &html.Node{
+		Type:      n.Type,
+		DataAtom:  n.DataAtom,
+		Data:      n.Data,
+		Namespace: n.Namespace,
+		Attr:      append([]html.Attribute(nil), n.Attr...),
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.AppendChild(cloneNode(child))
+	}
+	return c
+}
+
+// parseOuterHTML parses the outer HTML of a single element, as returned by a
+// browser. Fragments are parsed in a template context so that elements such
+// as <tr> or <li> survive on their own.
+func parseOuterHTML(s string) (*html.Node, error) {
+	tag := ""
+	tokenizer := html.NewTokenizer(strings.NewReader(s))
+	if tokenizer.Next() == html.StartTagToken {
+		name, _ := tokenizer.TagName()
+		tag = string(name)
+	}
+
+	switch tag {
+	case "html", "head", "body":
+		doc, err := html.Parse(strings.NewReader(s))
+		if err != nil {
+			return nil, err
+		}
+		if n := findElementByTag(doc, tag); n != nil {
+			n.Parent.RemoveChild(n)
+			return n, nil
+		}
+	default:
+		context := &html.Node{Type: html.ElementNode, Data: "template", DataAtom: atom.Template}
+		nodes, err := html.ParseFragment(strings.NewReader(s), context)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range nodes {
+			if n.Type == html.ElementNode {
+				return n, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no element in HTML")
+}
+
+func findElementByTag(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElementByTag(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// markupValue serialises the subtree of el as HTML, inner HTML or Markdown
+// depending on the field type, resolving links and sanitising on request.
+func (ev *evaluator) markupValue(el node, field Field) (string, error) {
+	n, err := el.Subtree()
+	if err != nil {
+		return "", fmt.Errorf("failed to get HTML of element: %v", err)
+	}
+	if field.Resolve {
+		ev.resolveLinks(n)
+	}
+	if field.Sanitize {
+		sanitized := sanitizePolicy.Sanitize(renderNodes(n))
+		if field.Type == "html" {
+			return sanitized, nil
+		}
+		// Parse the sanitised element back in a neutral wrapper, whose
+		// children then stand for the element.
+		wrapper := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+		nodes, err := html.ParseFragment(strings.NewReader(sanitized), wrapper)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse sanitised HTML: %v", err)
+		}
+		for _, c := range nodes {
+			wrapper.AppendChild(c)
+		}
+		if c := wrapper.FirstChild; c != nil && c == wrapper.LastChild && c.Type == html.ElementNode && c.Data == n.Data {
+			// The element itself survived sanitising. A lone child with
+			// another tag means the element was stripped around it.
+			n = c
+			n.Parent.RemoveChild(n)
+		} else {
+			n = wrapper
+		}
+	}
+
+	switch field.Type {
+	case "html":
+		return renderNodes(n), nil
+	case "inner_html":
+		return renderChildren(n), nil
+	default:
+		return toMarkdown(n), nil
+	}
+}
+
+// resolveLinks rewrites the link attributes in the subtree of n to absolute
+// URLs. Values that cannot be resolved are left alone.
+func (ev *evaluator) resolveLinks(n *html.Node) {
+	if n.Type == html.ElementNode {
+		for i, attr := range n.Attr {
+			for _, name := range linkAttributes {
+				if !strings.EqualFold(attr.Key, name) {
+					continue
+				}
+				var resolved string
+				var err error
+				if name == "srcset" {
+					resolved, err = ev.resolveSrcset(attr.Val)
+				} else {
+					resolved, err = resolveURL(ev.baseURL, attr.Val)
+				}
+				if err == nil {
+					n.Attr[i].Val = resolved
+				}
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		ev.resolveLinks(c)
+	}
+}
+
+// resolveSrcset resolves every candidate URL of a srcset attribute, keeping
+// the descriptors.
+func (ev *evaluator) resolveSrcset(srcset string) (string, error) {
+	candidates := splitSrcset(srcset)
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		resolved, err := resolveURL(ev.baseURL, fields[0])
+		if err != nil {
+			return "", err
+		}
+		fields[0] = resolved
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", "), nil
+}
+
+func renderNodes(nodes ...*html.Node) string {
+	var buf bytes.Buffer
+	for _, n := range nodes {
+		// Render only fails on write errors, which bytes.Buffer never has.
+		html.Render(&buf, n)
+	}
+	return buf.String()
+}
+
+func renderChildren(n *html.Node) string {
+	var children []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		children = append(children, c)
+	}
+	return renderNodes(children...)
+}
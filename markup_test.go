@@ -0,0 +1,66 @@
+package extractor
+
+import "testing"
+
+const markupFixture = `<html><body>
+<div id="post" class="post"><p>Hi <a href="../about" onclick="track()">there</a><script>alert(1)</script></p><img src="/a.png" srcset="a.png 1x, /b.png 2x"></div>
+<form id="form"><p>Inside <b>form</b></p></form>
+<custom id="custom"><span>Kept</span> text</custom>
+<div id="nested"><div class="inner"><p>Deep</p></div></div>
+</body></html>`
+
+func TestMarkupValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector string
+		typ      string
+		resolve  bool
+		sanitize bool
+		want     string
+	}{
+		{"html", "//div[@id='post']", "html", false, false,
+			`<div id="post" class="post"><p>Hi <a href="../about" onclick="track()">there</a><script>alert(1)</script></p><img src="/a.png" srcset="a.png 1x, /b.png 2x"/></div>`},
+		{"inner html", "//div[@id='post']", "inner_html", false, false,
+			`<p>Hi <a href="../about" onclick="track()">there</a><script>alert(1)</script></p><img src="/a.png" srcset="a.png 1x, /b.png 2x"/>`},
+		{"resolved links", "//div[@id='post']", "inner_html", true, false,
+			`<p>Hi <a href="https://example.com/about" onclick="track()">there</a><script>alert(1)</script></p><img src="https://example.com/a.png" srcset="https://example.com/dir/a.png 1x, https://example.com/b.png 2x"/>`},
+		{"sanitized html", "//div[@id='post']", "html", false, true,
+			`<div id="post"><p>Hi <a href="../about" rel="nofollow">there</a></p><img src="/a.png"/></div>`},
+		{"sanitized inner html", "//div[@id='post']", "inner_html", true, true,
+			`<p>Hi <a href="https://example.com/about" rel="nofollow">there</a></p><img src="https://example.com/a.png"/>`},
+		{"sanitized nested root", "//div[@id='nested']", "inner_html", false, true,
+			`<div><p>Deep</p></div>`},
+		{"stripped root keeps its only child", "//form", "inner_html", false, true,
+			`<p>Inside <b>form</b></p>`},
+		{"stripped root keeps its children", "//custom", "inner_html", false, true,
+			`<span>Kept</span> text`},
+		{"stripped root as html", "//form", "html", false, true,
+			`<p>Inside <b>form</b></p>`},
+		{"markdown", "//div[@id='post']", "markdown", true, false,
+			"Hi [there](https://example.com/about)\n\n![](https://example.com/a.png)"},
+		{"sanitized markdown of stripped root", "//form", "markdown", false, true,
+			"Inside **form**"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewStaticExtractor(ExtractorConfig{Schemas: []Schema{{
+				Name:     "page",
+				Selector: "//body",
+				Fields: []Field{
+					{Name: "value", Type: tt.typ, Selector: tt.selector, Resolve: tt.resolve, Sanitize: tt.sanitize},
+				},
+			}}})
+			result, err := e.ExtractHTML([]byte(markupFixture), "https://example.com/dir/page")
+			if err != nil {
+				t.Fatalf("ExtractHTML failed: %v", err)
+			}
+			items := result.SchemaResults["page"].Items
+			if len(items) != 1 {
+				t.Fatalf("got %d items, want 1; errors: %v", len(items), result.Errors)
+			}
+			if got := items[0]["value"]; got != tt.want {
+				t.Errorf("value = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
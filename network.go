@@ -0,0 +1,320 @@
+package extractor
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// FromNetwork makes a json field read the responses recorded by a network
+// capture instead of the page.
+const FromNetwork string = "network"
+
+// NetworkCapture records the responses of requests the page makes in
+// browser mode, such as the XHR and fetch calls to its API, so that fields
+// can extract from them.
+type NetworkCapture struct {
+	// Name is how fields refer to the capture.
+	Name string `json:"name"`
+	// URLPattern matches the URLs of the requests to record. "*" matches
+	// any number of characters and "?" a single one, e.g.
+	// "*/api/products*".
+	URLPattern string `json:"url_pattern"`
+}
+
+// BlockConfig lists requests the browser does not make in browser mode, to
+// cut page load time. Pages and frames are never blocked.
+type BlockConfig struct {
+	// ResourceTypes are the types of requests to block: image, media, font,
+	// stylesheet, script, xhr, fetch, texttrack, eventsource, manifest,
+	// ping, prefetch or other.
+	ResourceTypes []string `json:"resource_types,omitempty"`
+	// URLPatterns match the URLs of requests to block, with the same
+	// wildcards as NetworkCapture.URLPattern, e.g. "*.doubleclick.net/*".
+	URLPatterns []string `json:"url_patterns,omitempty"`
+}
+
+// blockableResourceTypes maps the names BlockConfig.ResourceTypes accepts to
+// the resource types of the browser.
+var blockableResourceTypes = map[string]proto.NetworkResourceType{
+	"image":       proto.NetworkResourceTypeImage,
+	"media":       proto.NetworkResourceTypeMedia,
+	"font":        proto.NetworkResourceTypeFont,
+	"stylesheet":  proto.NetworkResourceTypeStylesheet,
+	"script":      proto.NetworkResourceTypeScript,
+	"xhr":         proto.NetworkResourceTypeXHR,
+	"fetch":       proto.NetworkResourceTypeFetch,
+	"texttrack":   proto.NetworkResourceTypeTextTrack,
+	"eventsource": proto.NetworkResourceTypeEventSource,
+	"manifest":    proto.NetworkResourceTypeManifest,
+	"ping":        proto.NetworkResourceTypePing,
+	"prefetch":    proto.NetworkResourceTypePrefetch,
+	"other":       proto.NetworkResourceTypeOther,
+}
+
+// networkResponse is a recorded response with its body decoded as JSON.
+type networkResponse struct {
+	status int
+	value  interface{}
+	err    error
+}
+
+// networkRecorder holds the responses recorded for a page by capture name,
+// in the order they arrived, and counts the requests blocked by resource
+// type.
+type networkRecorder struct {
+	mu        sync.Mutex
+	responses map[string][]networkResponse
+	blocked   map[string]int
+}
+
+func (r *networkRecorder) record(name string, response networkResponse) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses[name] = append(r.responses[name], response)
+}
+
+func (r *networkRecorder) get(name string) []networkResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]networkResponse(nil), r.responses[name]...)
+}
+
+func (r *networkRecorder) countBlocked(resourceType proto.NetworkResourceType) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.blocked[strings.ToLower(string(resourceType))]++
+}
+
+// blockedCounts returns the number of blocked requests by resource type, or
+// nil if none were blocked.
+func (r *networkRecorder) blockedCounts() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.blocked) == 0 {
+		return nil
+	}
+	counts := make(map[string]int, len(r.blocked))
+	for resourceType, n := range r.blocked {
+		counts[resourceType] = n
+	}
+	return counts
+}
+
+// hijackPage routes the requests of page that the config blocks or
+// captures through a hijack router. Blocked requests fail and are counted,
+// captured ones are fetched and recorded, and the rest continue untouched.
+// A request is recorded by the first capture that matches it. Pages are only
+// hijacked when the config has rules, as hijacking disables the browser
+// cache. stop ends the routing.
+func hijackPage(page *rod.Page, compiled *CompiledConfig) (recorder *networkRecorder, stop func(), err error) {
+	var blockTypes map[proto.NetworkResourceType]bool
+	var blockURLs []*regexp.Regexp
+	if block := compiled.Block; block != nil {
+		blockTypes = make(map[proto.NetworkResourceType]bool)
+		for _, name := range block.ResourceTypes {
+			blockTypes[blockableResourceTypes[strings.ToLower(name)]] = true
+		}
+		for _, pattern := range block.URLPatterns {
+			blockURLs = append(blockURLs, wildcardRegexp(pattern))
+		}
+	}
+	if len(blockTypes) == 0 && len(blockURLs) == 0 && len(compiled.Network) == 0 {
+		return nil, func() {}, nil
+	}
+	captures := make([]*regexp.Regexp, len(compiled.Network))
+	for i, capture := range compiled.Network {
+		captures[i] = wildcardRegexp(capture.URLPattern)
+	}
+
+	recorder = &networkRecorder{
+		responses: make(map[string][]networkResponse),
+		blocked:   make(map[string]int),
+	}
+	client := &http.Client{
+		// Let the browser follow redirects, so that their targets are
+		// matched against the rules as well.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	// Every request the router pauses goes through route, which always
+	// settles it, so only the first handler registered ever runs.
+	route := func(h *rod.Hijack) {
+		url := h.Request.URL().String()
+		resourceType := h.Request.Type()
+		// Pages and frames are never blocked.
+		if resourceType != proto.NetworkResourceTypeDocument && (blockTypes[resourceType] || matchesAny(blockURLs, url)) {
+			recorder.countBlocked(resourceType)
+			h.Response.Fail(proto.NetworkErrorReasonBlockedByClient)
+			return
+		}
+		for i, re := range captures {
+			if !re.MatchString(url) {
+				continue
+			}
+			if err := loadResponse(page, h, client); err != nil {
+				h.Response.Fail(proto.NetworkErrorReasonFailed)
+				return
+			}
+			value, err := decodeJSON(h.Response.Payload().Body)
+			recorder.record(compiled.Network[i].Name, networkResponse{
+				status: h.Response.Payload().ResponseCode,
+				value:  value,
+				err:    err,
+			})
+			return
+		}
+		h.ContinueRequest(&proto.FetchContinueRequest{})
+	}
+
+	router := page.HijackRequests()
+	add := func(pattern string, resourceType proto.NetworkResourceType) error {
+		if err := router.Add(routerPattern(pattern), resourceType, route); err != nil {
+			_ = router.Stop()
+			return fmt.Errorf("failed to hijack %s: %v", pattern, err)
+		}
+		return nil
+	}
+	for resourceType := range blockTypes {
+		if err := add("*", resourceType); err != nil {
+			return nil, nil, err
+		}
+	}
+	if compiled.Block != nil {
+		for _, pattern := range compiled.Block.URLPatterns {
+			if err := add(pattern, ""); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	for _, capture := range compiled.Network {
+		if err := add(capture.URLPattern, ""); err != nil {
+			return nil, nil, err
+		}
+	}
+	go router.Run()
+	return recorder, func() { _ = router.Stop() }, nil
+}
+
+// wildcardRegexp compiles a URL pattern in which "*" matches any number of
+// characters and "?" a single one.
+func wildcardRegexp(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString(`\A`)
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString(`\z`)
+	return regexp.MustCompile(sb.String())
+}
+
+// routerPattern widens a URL pattern for the hijack router, which passes it
+// to the browser as a wildcard pattern but also reads it as a regular
+// expression. Characters with a meaning in either become "*", so that both
+// match at least what the pattern does; route checks the exact pattern.
+// Runs of "*" are collapsed, as the router cannot convert them.
+func routerPattern(pattern string) string {
+	pattern = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`?\+()[]{}|^$`, r) {
+			return '*'
+		}
+		return r
+	}, pattern)
+	for strings.Contains(pattern, "**") {
+		pattern = strings.ReplaceAll(pattern, "**", "*")
+	}
+	return pattern
+}
+
+func matchesAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadResponse fetches a hijacked request in place of the browser. The
+// browser's cookies are sent along, and the response is requested without
+// compression so that its body can be read.
+func loadResponse(page *rod.Page, h *rod.Hijack, client *http.Client) error {
+	req := h.Request.Req()
+	hasCookie := false
+	// The header names are as the browser reported them, which is not
+	// necessarily canonical.
+	for name := range req.Header {
+		switch {
+		case strings.EqualFold(name, "Accept-Encoding"):
+			delete(req.Header, name)
+		case strings.EqualFold(name, "Cookie"):
+			hasCookie = true
+		}
+	}
+	if !hasCookie {
+		cookies, err := page.Cookies([]string{req.URL.String()})
+		if err == nil && len(cookies) > 0 {
+			pairs := make([]string, len(cookies))
+			for i, cookie := range cookies {
+				pairs[i] = cookie.Name + "=" + cookie.Value
+			}
+			req.Header.Set("Cookie", strings.Join(pairs, "; "))
+		}
+	}
+	return h.LoadResponse(client, true)
+}
+
+// networkValue evaluates the path of a network field on the responses
+// recorded by its capture. Error responses and bodies that are not JSON are
+// skipped. Without Multiple the first match is returned.
+func (ev *evaluator) networkValue(field Field) (interface{}, error) {
+	root, ok := ev.root.(*rodNode)
+	if !ok || root.network == nil {
+		return nil, fmt.Errorf("network responses are only captured in browser mode")
+	}
+	name := field.Capture
+	if name == "" && len(ev.config.Network) == 1 {
+		name = ev.config.Network[0].Name
+	}
+	responses := root.network.get(name)
+	if len(responses) == 0 {
+		return nil, fmt.Errorf("no response captured for %s", name)
+	}
+
+	all := field
+	all.Multiple = true
+	var values []interface{}
+	for _, response := range responses {
+		if response.err != nil || response.status >= 400 {
+			continue
+		}
+		selected, err := ev.selectJSON(response.value, all)
+		if err != nil {
+			continue
+		}
+		values = append(values, selected.([]interface{})...)
+	}
+	if len(values) == 0 {
+		if field.Path == "" {
+			return nil, fmt.Errorf("no JSON response captured for %s", name)
+		}
+		return nil, fmt.Errorf("no value found at path %s in the responses captured for %s", field.Path, name)
+	}
+	if field.Multiple {
+		return values, nil
+	}
+	return values[0], nil
+}
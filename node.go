@@ -0,0 +1,432 @@
+package extractor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/antchfx/htmlquery"
+	"github.com/go-rod/rod"
+	"golang.org/x/net/html"
+)
+
+// node is the small DOM abstraction the field evaluator works against. It is
+// implemented for parsed HTML (static mode), for live rod elements
+// (browser mode), for decoded JSON values (json mode) and for parsed XML
+// (xml mode).
+type node interface {
+	// QueryOne returns the first node matching the selector relative to
+	// this node, or nil if nothing matches. selectorType is SelectorXPath,
+	// SelectorCSS or SelectorJSONPath; CSS selectors match descendants like
+	// querySelectorAll.
+	QueryOne(selectorType, selector string) (node, error)
+	// QueryAll returns every node matching the selector relative to this
+	// node.
+	QueryAll(selectorType, selector string) ([]node, error)
+	// Text returns the text content of the node.
+	Text() (string, error)
+	// Attribute returns the value of the named attribute and whether it is
+	// present.
+	Attribute(name string) (string, bool, error)
+	// Attributes returns every attribute of the node by name.
+	Attributes() (map[string]string, error)
+	// Subtree returns a detached copy of the node and its descendants that
+	// may be modified freely.
+	Subtree() (*html.Node, error)
+	// PageURL returns the URL of the page the node belongs to: its final
+	// URL after redirects, the same in every mode.
+	PageURL() string
+}
+
+// htmlNode adapts a node of a document parsed with htmlquery. Selectors
+// compiled by the config are evaluated with their precompiled form.
+type htmlNode struct {
+	n      *html.Node
+	url    string
+	config *CompiledConfig
+}
+
+func newHTMLNode(n *html.Node, url string, config *CompiledConfig) *htmlNode {
+	return &htmlNode{n: n, url: url, config: config}
+}
+
+func (h *htmlNode) QueryOne(selectorType, selector string) (node, error) {
+	if selectorType == SelectorCSS {
+		sel, err := h.config.css(selector)
+		if err != nil {
+			return nil, err
+		}
+		if nodes := sel.queryAll(h.n, true); len(nodes) > 0 {
+			return newHTMLNode(nodes[0], h.url, h.config), nil
+		}
+		return nil, nil
+	}
+
+	var n *html.Node
+	if expr, ok := h.config.xpaths[selector]; ok {
+		n = htmlquery.QuerySelector(h.n, expr)
+	} else {
+		var err error
+		if n, err = htmlquery.Query(h.n, selector); err != nil {
+			return nil, err
+		}
+	}
+	if n == nil {
+		return nil, nil
+	}
+	return newHTMLNode(n, h.url, h.config), nil
+}
+
+func (h *htmlNode) QueryAll(selectorType, selector string) ([]node, error) {
+	var nodes []*html.Node
+	if selectorType == SelectorCSS {
+		sel, err := h.config.css(selector)
+		if err != nil {
+			return nil, err
+		}
+		nodes = sel.queryAll(h.n, false)
+	} else if expr, ok := h.config.xpaths[selector]; ok {
+		nodes = htmlquery.QuerySelectorAll(h.n, expr)
+	} else {
+		var err error
+		if nodes, err = htmlquery.QueryAll(h.n, selector); err != nil {
+			return nil, err
+		}
+	}
+	result := make([]node, len(nodes))
+	for i, n := range nodes {
+		result[i] = newHTMLNode(n, h.url, h.config)
+	}
+	return result, nil
+}
+
+func (h *htmlNode) Text() (string, error) {
+	return htmlquery.InnerText(h.n), nil
+}
+
+func (h *htmlNode) Attribute(name string) (string, bool, error) {
+	for _, attr := range h.n.Attr {
+		if attr.Key == name {
+			return attr.Val, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (h *htmlNode) Attributes() (map[string]string, error) {
+	attributes := make(map[string]string, len(h.n.Attr))
+	for _, attr := range h.n.Attr {
+		attributes[attr.Key] = attr.Val
+	}
+	return attributes, nil
+}
+
+func (h *htmlNode) Subtree() (*html.Node, error) {
+	return cloneNode(h.n), nil
+}
+
+func (h *htmlNode) PageURL() string {
+	return h.url
+}
+
+// rodNode adapts an element of a live browser page. A rodNode without an
+// element stands for the document itself.
+type rodNode struct {
+	page *rod.Page
+	el   *rod.Element
+	url  string
+	// network holds the captured responses of the page; it is only set on
+	// the root node.
+	network *networkRecorder
+}
+
+func newRodNode(page *rod.Page, el *rod.Element, url string) *rodNode {
+	return &rodNode{page: page, el: el, url: url}
+}
+
+func (r *rodNode) QueryOne(selectorType, selector string) (node, error) {
+	var el *rod.Element
+	var err error
+	switch {
+	case r.el == nil && selectorType == SelectorCSS:
+		el, err = r.page.Sleeper(rod.NotFoundSleeper).Element(selector)
+	case r.el == nil:
+		el, err = r.page.Sleeper(rod.NotFoundSleeper).ElementX(selector)
+	case selectorType == SelectorCSS:
+		el, err = r.el.Element(selector)
+	default:
+		el, err = r.el.ElementX(selector)
+	}
+	var notFound *rod.ElementNotFoundError
+	if errors.As(err, &notFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newRodNode(r.page, el, r.url), nil
+}
+
+func (r *rodNode) QueryAll(selectorType, selector string) ([]node, error) {
+	var elements rod.Elements
+	var err error
+	switch {
+	case r.el == nil && selectorType == SelectorCSS:
+		elements, err = r.page.Elements(selector)
+	case r.el == nil:
+		elements, err = r.page.ElementsX(selector)
+	case selectorType == SelectorCSS:
+		elements, err = r.el.Elements(selector)
+	default:
+		elements, err = r.el.ElementsX(selector)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := make([]node, len(elements))
+	for i, el := range elements {
+		result[i] = newRodNode(r.page, el, r.url)
+	}
+	return result, nil
+}
+
+func (r *rodNode) element() (*rod.Element, error) {
+	if r.el != nil {
+		return r.el, nil
+	}
+	return r.page.Sleeper(rod.NotFoundSleeper).Element("html")
+}
+
+func (r *rodNode) Text() (string, error) {
+	el, err := r.element()
+	if err != nil {
+		return "", err
+	}
+	return el.Text()
+}
+
+func (r *rodNode) Attribute(name string) (string, bool, error) {
+	el, err := r.element()
+	if err != nil {
+		return "", false, err
+	}
+	value, err := el.Attribute(name)
+	if err != nil || value == nil {
+		return "", false, err
+	}
+	return *value, true, nil
+}
+
+func (r *rodNode) Attributes() (map[string]string, error) {
+	el, err := r.element()
+	if err != nil {
+		return nil, err
+	}
+	obj, err := el.Eval(`() => Object.fromEntries(Array.from(this.attributes, a => [a.name, a.value]))`)
+	if err != nil {
+		return nil, err
+	}
+	attributes := make(map[string]string)
+	if err := obj.Value.Unmarshal(&attributes); err != nil {
+		return nil, err
+	}
+	return attributes, nil
+}
+
+func (r *rodNode) Subtree() (*html.Node, error) {
+	el, err := r.element()
+	if err != nil {
+		return nil, err
+	}
+	outer, err := el.HTML()
+	if err != nil {
+		return nil, err
+	}
+	return parseOuterHTML(outer)
+}
+
+func (r *rodNode) PageURL() string {
+	return r.url
+}
+
+// jsonNode adapts a value decoded from a JSON document. Objects expose their
+// keys as attributes; selectors are JSONPath expressions relative to the
+// value.
+type jsonNode struct {
+	value  interface{}
+	url    string
+	config *CompiledConfig
+}
+
+func newJSONNode(value interface{}, url string, config *CompiledConfig) *jsonNode {
+	return &jsonNode{value: value, url: url, config: config}
+}
+
+func (j *jsonNode) evaluate(selectorType, selector string) ([]interface{}, error) {
+	if selectorType != SelectorJSONPath {
+		return nil, fmt.Errorf("selector type %q cannot be used on JSON", selectorType)
+	}
+	path, err := j.config.jsonPath(selector)
+	if err != nil {
+		return nil, err
+	}
+	return path.Evaluate(j.value), nil
+}
+
+func (j *jsonNode) QueryOne(selectorType, selector string) (node, error) {
+	values, err := j.evaluate(selectorType, selector)
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+	return newJSONNode(values[0], j.url, j.config), nil
+}
+
+func (j *jsonNode) QueryAll(selectorType, selector string) ([]node, error) {
+	values, err := j.evaluate(selectorType, selector)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]node, len(values))
+	for i, value := range values {
+		result[i] = newJSONNode(value, j.url, j.config)
+	}
+	return result, nil
+}
+
+// Text returns strings as they are, null as "" and other values as compact
+// JSON.
+func (j *jsonNode) Text() (string, error) {
+	switch v := j.value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	data, err := json.Marshal(j.value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (j *jsonNode) Attribute(name string) (string, bool, error) {
+	object, ok := j.value.(map[string]interface{})
+	if !ok {
+		return "", false, nil
+	}
+	value, ok := object[name]
+	if !ok {
+		return "", false, nil
+	}
+	text, err := newJSONNode(value, j.url, j.config).Text()
+	return text, true, err
+}
+
+// Attributes returns the keys of an object with their values as text.
+func (j *jsonNode) Attributes() (map[string]string, error) {
+	attributes := make(map[string]string)
+	object, _ := j.value.(map[string]interface{})
+	for key, value := range object {
+		text, err := newJSONNode(value, j.url, j.config).Text()
+		if err != nil {
+			return nil, err
+		}
+		attributes[key] = text
+	}
+	return attributes, nil
+}
+
+func (j *jsonNode) Subtree() (*html.Node, error) {
+	return nil, errors.New("JSON values have no HTML")
+}
+
+func (j *jsonNode) PageURL() string {
+	return j.url
+}
+
+// xmlNode adapts a node of a document parsed with parseXML. Selectors are
+// namespace-aware XPath expressions.
+type xmlNode struct {
+	n      *xmlTreeNode
+	url    string
+	config *CompiledConfig
+}
+
+func newXMLNode(n *xmlTreeNode, url string, config *CompiledConfig) *xmlNode {
+	return &xmlNode{n: n, url: url, config: config}
+}
+
+func (x *xmlNode) selectAll(selectorType, selector string, first bool) ([]*xmlTreeNode, error) {
+	if selectorType != SelectorXPath {
+		return nil, fmt.Errorf("selector type %q cannot be used on XML", selectorType)
+	}
+	expr, err := x.config.xpath(selector)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []*xmlTreeNode
+	t := expr.Select(newXMLNavigator(x.n))
+	for t.MoveNext() {
+		nodes = append(nodes, t.Current().(*xmlNavigator).current())
+		if first {
+			break
+		}
+	}
+	return nodes, nil
+}
+
+func (x *xmlNode) QueryOne(selectorType, selector string) (node, error) {
+	nodes, err := x.selectAll(selectorType, selector, true)
+	if err != nil || len(nodes) == 0 {
+		return nil, err
+	}
+	return newXMLNode(nodes[0], x.url, x.config), nil
+}
+
+func (x *xmlNode) QueryAll(selectorType, selector string) ([]node, error) {
+	nodes, err := x.selectAll(selectorType, selector, false)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]node, len(nodes))
+	for i, n := range nodes {
+		result[i] = newXMLNode(n, x.url, x.config)
+	}
+	return result, nil
+}
+
+func (x *xmlNode) Text() (string, error) {
+	return x.n.text(), nil
+}
+
+// Attribute looks attributes up by their name as written in the document,
+// e.g. "href" or "xml:lang".
+func (x *xmlNode) Attribute(name string) (string, bool, error) {
+	for _, a := range x.n.Attr {
+		if a.name() == name {
+			return a.Value, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (x *xmlNode) Attributes() (map[string]string, error) {
+	attributes := make(map[string]string, len(x.n.Attr))
+	for _, a := range x.n.Attr {
+		attributes[a.name()] = a.Value
+	}
+	return attributes, nil
+}
+
+func (x *xmlNode) Subtree() (*html.Node, error) {
+	return xmlToHTML(x.n), nil
+}
+
+func (x *xmlNode) PageURL() string {
+	return x.url
+}
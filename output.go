@@ -0,0 +1,126 @@
+package extractor
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Output types for Field.OutputType.
+const (
+	OutputString   string = "string"
+	OutputInt      string = "int"
+	OutputFloat    string = "float"
+	OutputBool     string = "bool"
+	OutputDatetime string = "datetime"
+	OutputURL      string = "url"
+	OutputArray    string = "array"
+	OutputObject   string = "object"
+)
+
+// coerce converts the extracted value of field to its declared output type.
+// nil values are left alone.
+func (ev *evaluator) coerce(value interface{}, field Field) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch field.OutputType {
+	case "":
+		return value, nil
+
+	case OutputString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		case time.Time:
+			return v.Format(time.RFC3339), nil
+		}
+
+	case OutputInt:
+		switch v := value.(type) {
+		case string:
+			return parseInt(v)
+		case int64:
+			return v, nil
+		case float64:
+			if v == float64(int64(v)) {
+				return int64(v), nil
+			}
+			return nil, fmt.Errorf("%v is not an integer", v)
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+
+	case OutputFloat:
+		switch v := value.(type) {
+		case string:
+			return parseFloat(v)
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+
+	case OutputBool:
+		switch v := value.(type) {
+		case string:
+			return parseBool(v)
+		case int64:
+			return v != 0, nil
+		case float64:
+			return v != 0, nil
+		case bool:
+			return v, nil
+		}
+
+	case OutputDatetime:
+		switch v := value.(type) {
+		case string:
+			parser, err := newTimeParser(&field)
+			if err != nil {
+				return nil, err
+			}
+			return parser.Parse(v)
+		case int64:
+			parser, err := newTimeParser(&field)
+			if err != nil {
+				return nil, err
+			}
+			return parser.Parse(strconv.FormatInt(v, 10))
+		case time.Time:
+			return v, nil
+		}
+
+	case OutputURL:
+		if v, ok := value.(string); ok {
+			return resolveURL(ev.baseURL, v)
+		}
+
+	case OutputArray:
+		switch v := value.(type) {
+		case []string, []interface{}, []map[string]interface{}:
+			return v, nil
+		default:
+			return []interface{}{v}, nil
+		}
+
+	case OutputObject:
+		switch v := value.(type) {
+		case ExtractedItem, map[string]interface{}:
+			return v, nil
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported output type %s", field.OutputType)
+	}
+	return nil, fmt.Errorf("cannot convert %T to %s", value, field.OutputType)
+}
@@ -0,0 +1,162 @@
+package extractor
+
+import (
+	"fmt"
+	neturl "net/url"
+	"strconv"
+	"strings"
+)
+
+// urlAttributes are tried in order by url fields that do not name an
+// attribute.
+var urlAttributes = []string{"href", "src"}
+
+// documentBaseURL returns the URL relative links of the document resolve
+// against: the <base href> of the page resolved against pageURL, or pageURL
+// itself.
+func documentBaseURL(root node, pageURL string) *neturl.URL {
+	base, err := neturl.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	el, err := root.QueryOne(SelectorXPath, "//head/base[@href]")
+	if err != nil || el == nil {
+		return base
+	}
+	href, ok, err := el.Attribute("href")
+	if err != nil || !ok {
+		return base
+	}
+	ref, err := neturl.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return base
+	}
+	return base.ResolveReference(ref)
+}
+
+// resolveURL resolves ref against base and normalises the result.
+func resolveURL(base *neturl.URL, ref string) (string, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return "", fmt.Errorf("empty URL")
+	}
+	u, err := neturl.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %v", ref, err)
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	return normalizeURL(u), nil
+}
+
+// normalizeURL lower-cases the scheme and host, drops default ports and
+// gives hierarchical URLs a non-empty path. Opaque URLs such as mailto: are
+// returned unchanged.
+func normalizeURL(u *neturl.URL) string {
+	if u.Opaque != "" {
+		return u.String()
+	}
+	normalizeHost(u)
+	if u.Host != "" && u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// normalizeHost lower-cases the scheme and host of u and drops the default
+// port of http and https.
+func normalizeHost(u *neturl.URL) {
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && strings.HasSuffix(u.Host, ":80")) ||
+		(u.Scheme == "https" && strings.HasSuffix(u.Host, ":443")) {
+		u.Host = u.Host[:strings.LastIndex(u.Host, ":")]
+	}
+}
+
+// largestSrcsetCandidate picks the candidate of a srcset attribute with the
+// largest width or pixel density descriptor. Candidates without descriptor
+// count as 1x.
+func largestSrcsetCandidate(srcset string) (string, error) {
+	best := ""
+	bestWidth, bestDensity := -1.0, -1.0
+	for _, candidate := range splitSrcset(srcset) {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		width, density := 0.0, 1.0
+		if len(fields) > 1 {
+			descriptor := fields[len(fields)-1]
+			value, err := strconv.ParseFloat(descriptor[:len(descriptor)-1], 64)
+			if err == nil {
+				switch descriptor[len(descriptor)-1] {
+				case 'w':
+					width, density = value, 0
+				case 'x':
+					density = value
+				}
+			}
+		}
+		if width > bestWidth || (width == bestWidth && density > bestDensity) {
+			best, bestWidth, bestDensity = fields[0], width, density
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("no candidate in srcset")
+	}
+	return best, nil
+}
+
+// splitSrcset splits a srcset into its candidates following the HTML
+// parsing rules: a candidate's URL runs up to whitespace, and commas inside
+// it are kept unless they end it. Descriptors run up to the next comma
+// outside parentheses, so "a.jpg 1x,b.jpg 2x" is two candidates.
+func splitSrcset(srcset string) []string {
+	var candidates []string
+	i := 0
+	for {
+		for i < len(srcset) && (isSrcsetSpace(srcset[i]) || srcset[i] == ',') {
+			i++
+		}
+		if i == len(srcset) {
+			return candidates
+		}
+		start := i
+		for i < len(srcset) && !isSrcsetSpace(srcset[i]) {
+			i++
+		}
+		url := srcset[start:i]
+		if strings.HasSuffix(url, ",") {
+			// Trailing commas end the candidate, which has no descriptors.
+			candidates = append(candidates, strings.TrimRight(url, ","))
+			continue
+		}
+		start = i
+		depth := 0
+	descriptors:
+		for ; i < len(srcset); i++ {
+			switch srcset[i] {
+			case '(':
+				depth++
+			case ')':
+				if depth > 0 {
+					depth--
+				}
+			case ',':
+				if depth == 0 {
+					break descriptors
+				}
+			}
+		}
+		if descriptors := strings.TrimSpace(srcset[start:i]); descriptors != "" {
+			url += " " + descriptors
+		}
+		candidates = append(candidates, url)
+	}
+}
+
+func isSrcsetSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,74 @@
+package extractor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitSrcset(t *testing.T) {
+	tests := []struct {
+		name   string
+		srcset string
+		want   []string
+	}{
+		{"empty", "", nil},
+		{"single url", "a.jpg", []string{"a.jpg"}},
+		{"spaced", "a.jpg 1x, b.jpg 2x", []string{"a.jpg 1x", "b.jpg 2x"}},
+		{"no spaces after commas", "a.jpg 1x,b.jpg 2x", []string{"a.jpg 1x", "b.jpg 2x"}},
+		{"width descriptors", "small.jpg 320w, large.jpg 1024w", []string{"small.jpg 320w", "large.jpg 1024w"}},
+		{"missing descriptor", "a.jpg, b.jpg 2x", []string{"a.jpg", "b.jpg 2x"}},
+		{"missing last descriptor", "a.jpg 1x, b.jpg", []string{"a.jpg 1x", "b.jpg"}},
+		{"comma in cdn url", "https://cdn.example.com/w_100,h_50/a.jpg 100w, https://cdn.example.com/w_200,h_100/a.jpg 200w",
+			[]string{"https://cdn.example.com/w_100,h_50/a.jpg 100w", "https://cdn.example.com/w_200,h_100/a.jpg 200w"}},
+		{"data url", "data:image/png;base64,iVBORw0KGgo= 1x, b.png 2x", []string{"data:image/png;base64,iVBORw0KGgo= 1x", "b.png 2x"}},
+		{"trailing comma", "a.jpg,", []string{"a.jpg"}},
+		{"several descriptors", "a.jpg 100w 2x, b.jpg", []string{"a.jpg 100w 2x", "b.jpg"}},
+		{"parenthesised descriptor", "a.jpg (x, y) 1x, b.jpg 2x", []string{"a.jpg (x, y) 1x", "b.jpg 2x"}},
+		{"extra whitespace and commas", " \n a.jpg \t 1x ,, b.jpg 2x , ", []string{"a.jpg 1x", "b.jpg 2x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitSrcset(tt.srcset)
+			if len(got) != len(tt.want) || strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("splitSrcset(%q) = %q, want %q", tt.srcset, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLargestSrcsetCandidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		srcset string
+		want   string
+	}{
+		{"single url", "a.jpg", "a.jpg"},
+		{"density", "a.jpg 1x,b.jpg 2x", "b.jpg"},
+		{"density out of order", "b.jpg 3x, a.jpg 1.5x", "b.jpg"},
+		{"width", "small.jpg 320w, large.jpg 1024w, medium.jpg 640w", "large.jpg"},
+		{"width over density", "a.jpg 3x, b.jpg 100w", "b.jpg"},
+		{"missing descriptor is 1x", "a.jpg, b.jpg 2x", "b.jpg"},
+		{"missing descriptor beats lower density", "a.jpg 0.5x, b.jpg", "b.jpg"},
+		{"first of equals", "a.jpg 2x, b.jpg 2x", "a.jpg"},
+		{"invalid descriptor is 1x", "a.jpg foo, b.jpg 1.5x", "b.jpg"},
+		{"comma in cdn url", "https://cdn.example.com/w_100,h_50/a.jpg 100w, https://cdn.example.com/w_800,h_400/a.jpg 800w",
+			"https://cdn.example.com/w_800,h_400/a.jpg"},
+		{"data url", "data:image/png;base64,iVBORw0KGgo= 2x, b.png 1x", "data:image/png;base64,iVBORw0KGgo="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := largestSrcsetCandidate(tt.srcset)
+			if err != nil {
+				t.Fatalf("largestSrcsetCandidate(%q) failed: %v", tt.srcset, err)
+			}
+			if got != tt.want {
+				t.Errorf("largestSrcsetCandidate(%q) = %q, want %q", tt.srcset, got, tt.want)
+			}
+		})
+	}
+	for _, srcset := range []string{"", " , ,"} {
+		if got, err := largestSrcsetCandidate(srcset); err == nil {
+			t.Errorf("largestSrcsetCandidate(%q) = %q, want an error", srcset, got)
+		}
+	}
+}
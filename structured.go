@@ -0,0 +1,426 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Field types for structured data embedded in pages.
+const (
+	FieldJSONLD    string = "jsonld"
+	FieldMicrodata string = "microdata"
+	FieldRDFa      string = "rdfa"
+	FieldOpenGraph string = "opengraph"
+)
+
+// structuredValue parses the structured data of the field type found in the
+// scope of the field, keeps the items whose type matches ItemType and
+// applies Path to each. Without Multiple the first result is returned.
+func (ev *evaluator) structuredValue(element node, field Field) (interface{}, error) {
+	n, err := ev.rootTree()
+	if field.Selector != "" || len(field.Selectors) > 0 {
+		var el node
+		if el, err = ev.findFieldElement(field, element); err != nil {
+			return nil, err
+		}
+		n, err = el.Subtree()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HTML of element: %v", err)
+	}
+
+	var items []map[string]interface{}
+	switch field.Type {
+	case FieldJSONLD:
+		items = parseJSONLD(n)
+	case FieldMicrodata:
+		items = parseMicrodata(n, ev)
+	case FieldRDFa:
+		items = parseRDFa(n, ev)
+	case FieldOpenGraph:
+		if og := parseOpenGraph(n); len(og) > 0 {
+			items = append(items, og)
+		}
+	}
+
+	var path *jsonPath
+	if field.Path != "" {
+		if path, err = ev.config.jsonPath(field.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	var values []interface{}
+	for _, item := range items {
+		if field.ItemType != "" && !matchesItemType(item, field.ItemType) {
+			continue
+		}
+		if path == nil {
+			values = append(values, item)
+			continue
+		}
+		values = append(values, path.Evaluate(item)...)
+	}
+
+	if field.Multiple {
+		if len(values) == 0 {
+			return nil, fmt.Errorf("no %s data found", field.Type)
+		}
+		return values, nil
+	}
+	if len(values) == 0 {
+		if field.ItemType != "" {
+			return nil, fmt.Errorf("no %s item of type %s found", field.Type, field.ItemType)
+		}
+		return nil, fmt.Errorf("no %s data found", field.Type)
+	}
+	return values[0], nil
+}
+
+// rootTree returns the parsed document, which is shared by the structured
+// data fields of all items and must not be modified.
+func (ev *evaluator) rootTree() (*html.Node, error) {
+	if ev.tree == nil {
+		tree, err := ev.root.Subtree()
+		if err != nil {
+			return nil, err
+		}
+		ev.tree = tree
+	}
+	return ev.tree, nil
+}
+
+// matchesItemType reports whether the @type of item, or the og:type of
+// OpenGraph data, is itemType. Types given as URLs such as
+// https://schema.org/Product also match their last segment.
+func matchesItemType(item map[string]interface{}, itemType string) bool {
+	var types []interface{}
+	switch t := item["@type"].(type) {
+	case string:
+		types = []interface{}{t}
+	case []interface{}:
+		types = t
+	}
+	if t, ok := item["type"].(string); ok && item["@type"] == nil {
+		types = append(types, t)
+	}
+	for _, t := range types {
+		s, ok := t.(string)
+		if !ok {
+			continue
+		}
+		if strings.EqualFold(s, itemType) {
+			return true
+		}
+		if i := strings.LastIndexAny(s, "/#:"); i >= 0 && strings.EqualFold(s[i+1:], itemType) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseJSONLD decodes every application/ld+json script below n. Arrays and
+// @graph containers are flattened into their items. Scripts that are not
+// valid JSON are skipped.
+func parseJSONLD(n *html.Node) []map[string]interface{} {
+	var items []map[string]interface{}
+	var add func(value interface{})
+	add = func(value interface{}) {
+		switch v := value.(type) {
+		case []interface{}:
+			for _, elem := range v {
+				add(elem)
+			}
+		case map[string]interface{}:
+			if graph, ok := v["@graph"]; ok {
+				add(graph)
+				return
+			}
+			items = append(items, v)
+		}
+	}
+
+	walkElements(n, func(el *html.Node) bool {
+		if el.Data != "script" {
+			return true
+		}
+		scriptType, _ := nodeAttribute(el, "type")
+		if i := strings.IndexByte(scriptType, ';'); i >= 0 {
+			scriptType = scriptType[:i]
+		}
+		if !strings.EqualFold(strings.TrimSpace(scriptType), "application/ld+json") {
+			return false
+		}
+		text := strings.TrimSpace(textContent(el))
+		text = strings.TrimPrefix(text, "<!--")
+		text = strings.TrimSuffix(text, "-->")
+		text = strings.TrimSuffix(strings.TrimSpace(text), ";")
+		var value interface{}
+		if err := json.Unmarshal([]byte(text), &value); err == nil {
+			add(value)
+		}
+		return false
+	})
+	return items
+}
+
+// parseMicrodata returns the top-level microdata items below n: elements
+// with itemscope that are not themselves a property of another item.
+func parseMicrodata(n *html.Node, ev *evaluator) []map[string]interface{} {
+	var items []map[string]interface{}
+	walkElements(n, func(el *html.Node) bool {
+		if !hasAttribute(el, "itemscope") {
+			return true
+		}
+		if !hasAttribute(el, "itemprop") {
+			items = append(items, microdataItem(el, ev))
+		}
+		// Nested items are reached through their properties.
+		return true
+	})
+	return items
+}
+
+func microdataItem(scope *html.Node, ev *evaluator) map[string]interface{} {
+	item := make(map[string]interface{})
+	if itemType, ok := nodeAttribute(scope, "itemtype"); ok {
+		if types := strings.Fields(itemType); len(types) == 1 {
+			item["@type"] = types[0]
+		} else if len(types) > 1 {
+			list := make([]interface{}, len(types))
+			for i, t := range types {
+				list[i] = t
+			}
+			item["@type"] = list
+		}
+	}
+	if id, ok := nodeAttribute(scope, "itemid"); ok {
+		item["@id"] = strings.TrimSpace(id)
+	}
+
+	var visit func(el *html.Node)
+	visit = func(el *html.Node) {
+		for c := el.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			names, isProperty := nodeAttribute(c, "itemprop")
+			nested := hasAttribute(c, "itemscope")
+			if isProperty {
+				var value interface{}
+				if nested {
+					value = microdataItem(c, ev)
+				} else {
+					value = microdataValue(c, ev)
+				}
+				for _, name := range strings.Fields(names) {
+					addProperty(item, name, value)
+				}
+			}
+			if !nested {
+				visit(c)
+			}
+		}
+	}
+	visit(scope)
+	return item
+}
+
+// microdataValue returns the value of a property element as defined by the
+// HTML microdata specification.
+func microdataValue(el *html.Node, ev *evaluator) interface{} {
+	switch el.Data {
+	case "meta":
+		value, _ := nodeAttribute(el, "content")
+		return value
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		return ev.linkValue(el, "src")
+	case "a", "area", "link":
+		return ev.linkValue(el, "href")
+	case "object":
+		return ev.linkValue(el, "data")
+	case "data", "meter":
+		value, _ := nodeAttribute(el, "value")
+		return value
+	case "time":
+		if value, ok := nodeAttribute(el, "datetime"); ok {
+			return value
+		}
+	}
+	if value, ok := nodeAttribute(el, "content"); ok {
+		return value
+	}
+	return normalizeText(textContent(el))
+}
+
+// parseRDFa returns the top-level RDFa Lite items below n: elements with
+// typeof that are not themselves a property of another item.
+func parseRDFa(n *html.Node, ev *evaluator) []map[string]interface{} {
+	var items []map[string]interface{}
+	walkElements(n, func(el *html.Node) bool {
+		if !hasAttribute(el, "typeof") {
+			return true
+		}
+		if !hasAttribute(el, "property") {
+			items = append(items, rdfaItem(el, ev))
+		}
+		return true
+	})
+	return items
+}
+
+func rdfaItem(scope *html.Node, ev *evaluator) map[string]interface{} {
+	item := make(map[string]interface{})
+	vocab := inheritedAttribute(scope, "vocab")
+	if typeOf, _ := nodeAttribute(scope, "typeof"); strings.TrimSpace(typeOf) != "" {
+		types := strings.Fields(typeOf)
+		for i, t := range types {
+			if vocab != "" && !strings.Contains(t, ":") {
+				types[i] = vocab + t
+			}
+		}
+		if len(types) == 1 {
+			item["@type"] = types[0]
+		} else {
+			list := make([]interface{}, len(types))
+			for i, t := range types {
+				list[i] = t
+			}
+			item["@type"] = list
+		}
+	}
+	if resource, ok := nodeAttribute(scope, "resource"); ok {
+		item["@id"] = resource
+	}
+
+	var visit func(el *html.Node)
+	visit = func(el *html.Node) {
+		for c := el.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			names, isProperty := nodeAttribute(c, "property")
+			nested := hasAttribute(c, "typeof")
+			if isProperty {
+				var value interface{}
+				if nested {
+					value = rdfaItem(c, ev)
+				} else {
+					value = rdfaValue(c, ev)
+				}
+				for _, name := range strings.Fields(names) {
+					addProperty(item, name, value)
+				}
+			}
+			if !nested {
+				visit(c)
+			}
+		}
+	}
+	visit(scope)
+	return item
+}
+
+func rdfaValue(el *html.Node, ev *evaluator) interface{} {
+	if value, ok := nodeAttribute(el, "content"); ok {
+		return value
+	}
+	for _, attribute := range []string{"href", "src", "resource"} {
+		if _, ok := nodeAttribute(el, attribute); ok {
+			return ev.linkValue(el, attribute)
+		}
+	}
+	if el.Data == "time" {
+		if value, ok := nodeAttribute(el, "datetime"); ok {
+			return value
+		}
+	}
+	return normalizeText(textContent(el))
+}
+
+// parseOpenGraph collects the og:, article:, book:, profile:, music:,
+// video: and twitter: <meta> tags below n. The og: prefix is dropped, other
+// prefixes are kept, and repeated properties become lists.
+func parseOpenGraph(n *html.Node) map[string]interface{} {
+	data := make(map[string]interface{})
+	walkElements(n, func(el *html.Node) bool {
+		if el.Data != "meta" {
+			return true
+		}
+		name, ok := nodeAttribute(el, "property")
+		if !ok {
+			name, _ = nodeAttribute(el, "name")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		prefix := name
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			prefix = name[:i]
+		}
+		switch prefix {
+		case "og", "article", "book", "profile", "music", "video", "twitter":
+		default:
+			return false
+		}
+		content, _ := nodeAttribute(el, "content")
+		addProperty(data, strings.TrimPrefix(name, "og:"), content)
+		return false
+	})
+	return data
+}
+
+// addProperty sets item[name], turning repeated properties into a list.
+func addProperty(item map[string]interface{}, name string, value interface{}) {
+	existing, ok := item[name]
+	if !ok {
+		item[name] = value
+		return
+	}
+	if list, ok := existing.([]interface{}); ok {
+		item[name] = append(list, value)
+		return
+	}
+	item[name] = []interface{}{existing, value}
+}
+
+// linkValue returns the named link attribute of el as an absolute URL, or
+// as it is if it cannot be resolved.
+func (ev *evaluator) linkValue(el *html.Node, attribute string) string {
+	value, _ := nodeAttribute(el, attribute)
+	if resolved, err := resolveURL(ev.baseURL, value); err == nil {
+		return resolved
+	}
+	return value
+}
+
+// walkElements calls fn for every element below and including n in
+// document order. fn returns whether to descend into the element.
+func walkElements(n *html.Node, fn func(el *html.Node) bool) {
+	if n.Type == html.ElementNode && !fn(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkElements(c, fn)
+	}
+}
+
+func hasAttribute(n *html.Node, name string) bool {
+	_, ok := nodeAttribute(n, name)
+	return ok
+}
+
+// inheritedAttribute returns the value of the named attribute on n or its
+// closest ancestor that has it.
+func inheritedAttribute(n *html.Node, name string) string {
+	for ; n != nil; n = n.Parent {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		if value, ok := nodeAttribute(n, name); ok {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,313 @@
+package extractor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// FieldTable is the field type for HTML tables.
+const FieldTable = "table"
+
+// Formats for Field.TableFormat.
+const (
+	TableRows string = "rows"
+	TableMap  string = "map"
+)
+
+// Limits from the HTML table processing model.
+const (
+	maxColspan = 1000
+	maxRowspan = 65534
+)
+
+type tableCell struct {
+	text   string
+	header bool
+}
+
+// tableValue reads the table matched by the field, or the first table
+// inside it, as rows keyed by header or as a key-value map.
+func (ev *evaluator) tableValue(el node, field Field) (interface{}, error) {
+	n, err := el.Subtree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HTML of element: %v", err)
+	}
+	table := findElementByTag(n, "table")
+	if table == nil {
+		return nil, fmt.Errorf("no table found for selector: %s", selectorsString(field))
+	}
+	head, body := tableRows(table)
+
+	// Without a thead, a first row of th cells is the header.
+	if len(head) == 0 && len(body) > 0 && isHeaderRow(body[0]) {
+		head, body = body[:1], body[1:]
+	}
+
+	format := field.TableFormat
+	if format == "" {
+		format = TableRows
+		if len(head) == 0 && len(field.Headers) == 0 && isTwoColumn(body) {
+			format = TableMap
+		}
+	}
+	if format == TableMap {
+		return tableMap(body)
+	}
+
+	headers := field.Headers
+	if len(headers) == 0 {
+		if len(head) == 0 && len(body) > 0 {
+			// Fall back to the first row as the header.
+			head, body = body[:1], body[1:]
+		}
+		headers = combineHeaders(head)
+	}
+	names := columnNames(headers, body)
+
+	var rows []map[string]interface{}
+	for _, row := range body {
+		item := make(map[string]interface{})
+		empty := true
+		for i, cell := range row {
+			item[names[i]] = cell.text
+			if cell.text != "" {
+				empty = false
+			}
+		}
+		if !empty {
+			rows = append(rows, item)
+		}
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no rows found in table: %s", selectorsString(field))
+	}
+	return rows, nil
+}
+
+// tableMap maps the first cell of every row to the second one, or to the
+// list of the other cells for wider rows. Trailing colons are dropped from
+// the keys and repeated keys collect their values in a list.
+func tableMap(body [][]tableCell) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	for _, row := range body {
+		if len(row) < 2 {
+			continue
+		}
+		key := strings.TrimSpace(strings.TrimRight(row[0].text, ":："))
+		if key == "" {
+			continue
+		}
+		var value interface{} = row[1].text
+		if len(row) > 2 {
+			values := make([]interface{}, 0, len(row)-1)
+			for _, cell := range row[1:] {
+				values = append(values, cell.text)
+			}
+			value = values
+		}
+		addProperty(result, key, value)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no key-value rows found in table")
+	}
+	return result, nil
+}
+
+// tableRows returns the rows of the thead and of the other row groups of
+// table with colspan and rowspan expanded, so that every cell sits in the
+// column it covers. Nested tables are not descended into.
+func tableRows(table *html.Node) (head, body [][]tableCell) {
+	var loose []*html.Node
+	flush := func() {
+		body = append(body, expandRows(loose)...)
+		loose = nil
+	}
+	for c := table.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.Data {
+		case "tr":
+			loose = append(loose, c)
+		case "thead":
+			flush()
+			head = append(head, expandRows(childElements(c, "tr"))...)
+		case "tbody", "tfoot":
+			flush()
+			body = append(body, expandRows(childElements(c, "tr"))...)
+		}
+	}
+	flush()
+	return head, body
+}
+
+func childElements(n *html.Node, tag string) []*html.Node {
+	var elements []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == tag {
+			elements = append(elements, c)
+		}
+	}
+	return elements
+}
+
+// expandRows lays the cells of the rows of one row group out on a grid.
+func expandRows(rows []*html.Node) [][]tableCell {
+	type span struct {
+		cell      tableCell
+		remaining int
+	}
+	pending := make(map[int]*span)
+	grid := make([][]tableCell, 0, len(rows))
+
+	for i, tr := range rows {
+		var row []tableCell
+		col := 0
+		// fill places the cells of earlier rows that span into this one.
+		fill := func() {
+			for {
+				s, ok := pending[col]
+				if !ok {
+					return
+				}
+				row = append(row, s.cell)
+				if s.remaining--; s.remaining == 0 {
+					delete(pending, col)
+				}
+				col++
+			}
+		}
+
+		for td := tr.FirstChild; td != nil; td = td.NextSibling {
+			if td.Type != html.ElementNode || (td.Data != "td" && td.Data != "th") {
+				continue
+			}
+			fill()
+			cell := tableCell{
+				text:   strings.Join(strings.Fields(textContent(td)), " "),
+				header: td.Data == "th",
+			}
+			colspan := spanAttribute(td, "colspan", 1, maxColspan)
+			rowspan := spanAttribute(td, "rowspan", 1, maxRowspan)
+			if rowspan == 0 || rowspan > len(rows)-i {
+				// rowspan="0" spans the rest of the row group.
+				rowspan = len(rows) - i
+			}
+			for j := 0; j < colspan; j++ {
+				row = append(row, cell)
+				if rowspan > 1 {
+					pending[col] = &span{cell: cell, remaining: rowspan - 1}
+				}
+				col++
+			}
+		}
+		// Cells spanning into columns after the last cell of this row.
+		for {
+			fill()
+			last := -1
+			for c := range pending {
+				if c > last {
+					last = c
+				}
+			}
+			if last < col {
+				break
+			}
+			row = append(row, tableCell{})
+			col++
+		}
+		grid = append(grid, row)
+	}
+	return grid
+}
+
+// spanAttribute parses a colspan or rowspan attribute, returning def when it
+// is missing or invalid.
+func spanAttribute(n *html.Node, name string, def, max int) int {
+	value, ok := nodeAttribute(n, name)
+	if !ok {
+		return def
+	}
+	span, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || span < 0 || (span == 0 && name == "colspan") {
+		return def
+	}
+	if span > max {
+		return max
+	}
+	return span
+}
+
+func isHeaderRow(row []tableCell) bool {
+	for _, cell := range row {
+		if !cell.header {
+			return false
+		}
+	}
+	return len(row) > 0
+}
+
+// isTwoColumn reports whether the widest row of a table has two cells.
+func isTwoColumn(rows [][]tableCell) bool {
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	return width == 2
+}
+
+// combineHeaders joins the texts of several header rows per column, e.g.
+// "Price" spanning "Min" and "Max" gives "Price Min" and "Price Max".
+func combineHeaders(head [][]tableCell) []string {
+	var headers, last []string
+	for _, row := range head {
+		for i, cell := range row {
+			if i == len(headers) {
+				headers = append(headers, "")
+				last = append(last, "")
+			}
+			// Cells spanning several header rows are only used once.
+			if cell.text == "" || cell.text == last[i] {
+				continue
+			}
+			if headers[i] != "" {
+				headers[i] += " "
+			}
+			headers[i] += cell.text
+			last[i] = cell.text
+		}
+	}
+	return headers
+}
+
+// columnNames returns a unique key for every column of body. Columns
+// without a header are named column_1, column_2 and so on.
+func columnNames(headers []string, body [][]tableCell) []string {
+	width := len(headers)
+	for _, row := range body {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	names := make([]string, width)
+	seen := make(map[string]int)
+	for i := range names {
+		name := ""
+		if i < len(headers) {
+			name = strings.TrimSpace(headers[i])
+		}
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		if seen[name]++; seen[name] > 1 {
+			name = fmt.Sprintf("%s_%d", name, seen[name])
+		}
+		names[i] = name
+	}
+	return names
+}
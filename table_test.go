@@ -0,0 +1,183 @@
+package extractor
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// gridString renders a grid of cells as rows separated by ";" and cells by
+// "|", with header cells marked by a leading "#".
+func gridString(grid [][]tableCell) string {
+	rows := make([]string, len(grid))
+	for i, row := range grid {
+		cells := make([]string, len(row))
+		for j, cell := range row {
+			cells[j] = cell.text
+			if cell.header {
+				cells[j] = "#" + cell.text
+			}
+		}
+		rows[i] = strings.Join(cells, "|")
+	}
+	return strings.Join(rows, ";")
+}
+
+func TestTableRows(t *testing.T) {
+	tests := []struct {
+		name  string
+		table string
+		head  string
+		body  string
+	}{
+		{"plain", `<tr><td>a</td><td>b</td></tr><tr><td>c</td><td>d</td></tr>`, "", "a|b;c|d"},
+		{"rowspan across rows", `<tr><td rowspan="3">A</td><td>1</td></tr><tr><td>2</td></tr><tr><td>3</td></tr>`, "", "A|1;A|2;A|3"},
+		{"rowspan in a middle column", `<tr><td>a</td><td rowspan="2">B</td><td>c</td></tr><tr><td>d</td><td>e</td></tr>`, "", "a|B|c;d|B|e"},
+		{"colspan in header", `<thead><tr><th colspan="2">Price</th><th>Stock</th></tr></thead><tr><td>1</td><td>2</td><td>3</td></tr>`,
+			"#Price|#Price|#Stock", "1|2|3"},
+		{"colspan and rowspan", `<tr><td colspan="2" rowspan="2">X</td><td>a</td></tr><tr><td>b</td></tr><tr><td>c</td><td>d</td><td>e</td></tr>`,
+			"", "X|X|a;X|X|b;c|d|e"},
+		{"ragged rows", `<tr><td>a</td><td>b</td><td>c</td></tr><tr><td>d</td></tr><tr></tr>`, "", "a|b|c;d;"},
+		{"rowspan past the table edge", `<tr><td rowspan="5">A</td><td>1</td></tr><tr><td>2</td></tr>`, "", "A|1;A|2"},
+		{"rowspan into a shorter row", `<tr><td>a</td><td rowspan="2">B</td></tr><tr></tr>`, "", "a|B;|B"},
+		{"rowspan zero spans the group", `<tbody><tr><td rowspan="0">A</td><td>1</td></tr><tr><td>2</td></tr></tbody><tbody><tr><td>x</td></tr></tbody>`,
+			"", "A|1;A|2;x"},
+		{"rowspan stays in its group", `<thead><tr><th rowspan="3">H</th><th>a</th></tr></thead><tbody><tr><td>1</td><td>2</td></tr></tbody>`,
+			"#H|#a", "1|2"},
+		{"invalid spans", `<tr><td colspan="0">a</td><td colspan="x" rowspan="-1">b</td></tr><tr><td>c</td></tr>`, "", "a|b;c"},
+		{"huge colspan is capped", `<tr><td colspan="5000">a</td></tr>`, "", strings.Repeat("a|", maxColspan-1) + "a"},
+		{"loose rows and groups", `<tr><td>a</td></tr><thead><tr><th>h</th></tr></thead><tbody><tr><td>b</td></tr></tbody><tfoot><tr><td>f</td></tr></tfoot>`,
+			"#h", "a;b;f"},
+		{"nested table", `<tr><td>a <table><tr><td>inner</td></tr></table></td><td>b</td></tr>`, "", "a inner|b"},
+		{"whitespace", "<tr><td>  a \n b </td><th> h </th></tr>", "", "a b|#h"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := parseOuterHTML("<table>" + tt.table + "</table>")
+			if err != nil {
+				t.Fatalf("parseOuterHTML failed: %v", err)
+			}
+			head, body := tableRows(table)
+			if got := gridString(head); got != tt.head {
+				t.Errorf("head = %q, want %q", got, tt.head)
+			}
+			if got := gridString(body); got != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
+
+// cellGrid builds a grid from rows of cell texts separated by "|".
+func cellGrid(rows ...string) [][]tableCell {
+	grid := make([][]tableCell, len(rows))
+	for i, row := range rows {
+		for _, text := range strings.Split(row, "|") {
+			grid[i] = append(grid[i], tableCell{text: text})
+		}
+	}
+	return grid
+}
+
+func TestCombineHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		head [][]tableCell
+		want []string
+	}{
+		{"single row", cellGrid("Name|Price"), []string{"Name", "Price"}},
+		{"two rows", cellGrid("Name|Price|Price", "Name|Min|Max"), []string{"Name", "Price Min", "Price Max"}},
+		{"three rows", cellGrid("A|A", "B|C", "D|D"), []string{"A B D", "A C D"}},
+		{"empty cells", cellGrid("|Size", "Item|"), []string{"Item", "Size"}},
+		{"ragged rows", cellGrid("A", "B|C"), []string{"A B", "C"}},
+		{"no rows", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := combineHeaders(tt.head)
+			if len(got) != len(tt.want) || strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("combineHeaders = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTableMap(t *testing.T) {
+	tests := []struct {
+		name string
+		body [][]tableCell
+		want string
+	}{
+		{"pairs", cellGrid("Color:|Red", "Size：|L"), `{"Color":"Red","Size":"L"}`},
+		{"wide rows", cellGrid("Sizes|S|M|L"), `{"Sizes":["S","M","L"]}`},
+		{"repeated keys", cellGrid("Tag|a", "Tag|b", "Tag|c"), `{"Tag":["a","b","c"]}`},
+		{"short and keyless rows", cellGrid("Alone", ":|x", "Key|v"), `{"Key":"v"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tableMap(tt.body)
+			if err != nil {
+				t.Fatalf("tableMap failed: %v", err)
+			}
+			got, err := json.Marshal(value)
+			if err != nil {
+				t.Fatalf("failed to encode result: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("tableMap = %s, want %s", got, tt.want)
+			}
+		})
+	}
+	if value, err := tableMap(cellGrid("only", ":|x")); err == nil {
+		t.Errorf("tableMap = %v, want an error", value)
+	}
+}
+
+func TestTableField(t *testing.T) {
+	tests := []struct {
+		name  string
+		table string
+		field Field
+		want  string
+	}{
+		{"combined headers", `<table><thead><tr><th rowspan="2">Model</th><th colspan="2">Price</th></tr><tr><th>Min</th><th>Max</th></tr></thead>
+			<tbody><tr><td>A</td><td>1</td><td>2</td></tr><tr><td>B</td><td>3</td><td>4</td></tr></tbody></table>`,
+			Field{}, `[{"Model":"A","Price Max":"2","Price Min":"1"},{"Model":"B","Price Max":"4","Price Min":"3"}]`},
+		{"th row as header", `<table><tr><th>Size</th><th>Chest</th><th>Waist</th></tr><tr><td>S</td><td>90</td></tr><tr><td></td><td></td></tr></table>`,
+			Field{}, `[{"Chest":"90","Size":"S"}]`},
+		{"ragged rows without headers", `<table><tr><td>a</td><td>b</td><td>c</td></tr><tr><td>d</td><td>e</td><td>f</td><td>g</td></tr></table>`,
+			Field{Headers: []string{"x", "y"}}, `[{"column_3":"c","x":"a","y":"b"},{"column_3":"f","column_4":"g","x":"d","y":"e"}]`},
+		{"duplicate headers", `<table><tr><th>A</th><th>A</th><th></th></tr><tr><td>1</td><td>2</td><td>3</td></tr></table>`,
+			Field{}, `[{"A":"1","A_2":"2","column_3":"3"}]`},
+		{"two columns as map", `<table><tr><td>Color</td><td>Red</td></tr><tr><td rowspan="2">Tag</td><td>a</td></tr><tr><td>b</td></tr></table>`,
+			Field{}, `{"Color":"Red","Tag":["a","b"]}`},
+		{"forced rows", `<table><tr><td>Color</td><td>Red</td></tr><tr><td>Size</td><td>L</td></tr></table>`,
+			Field{TableFormat: TableRows}, `[{"Color":"Size","Red":"L"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field := tt.field
+			field.Name, field.Type, field.Selector = "table", FieldTable, ".//table"
+			e := NewStaticExtractor(ExtractorConfig{Schemas: []Schema{{
+				Name:     "page",
+				Selector: "//body",
+				Fields:   []Field{field},
+			}}})
+			result, err := e.ExtractHTML([]byte("<html><body>"+tt.table+"</body></html>"), "https://example.com/")
+			if err != nil {
+				t.Fatalf("ExtractHTML failed: %v", err)
+			}
+			items := result.SchemaResults["page"].Items
+			if len(items) != 1 {
+				t.Fatalf("got %d items, want 1; errors: %v", len(items), result.Errors)
+			}
+			got, err := json.Marshal(items[0]["table"])
+			if err != nil {
+				t.Fatalf("failed to encode table: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("table = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package extractor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimezone is the location used for _time values that carry no zone
+// information when the field does not set one.
+const DefaultTimezone = "Asia/Hong_Kong"
+
+// defaultTimeLayouts are tried after the layouts configured on the field.
+var defaultTimeLayouts = []string{
+	"2006/01/02",
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/1/2",
+	"2006.01.02",
+	"20060102",
+	"2006年1月2日 15:04:05",
+	"2006年1月2日 15:04",
+	"2006年1月2日",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC850,
+	time.ANSIC,
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"2 Jan 2006",
+	"2 January 2006",
+}
+
+var (
+	relativeAgoRegexp = regexp.MustCompile(`^(\d+|an?)\s*(second|sec|minute|min|hour|hr|day|week|month|year)s?\s+ago$`)
+	relativeCNRegexp  = regexp.MustCompile(`^(\d+)\s*(秒|分钟|小时|天|周|个月|月|年)前$`)
+	relativeDayRegexp = regexp.MustCompile(`^(today|yesterday|今天|昨天|前天)\s*(\d{1,2}:\d{2}(?::\d{2})?)?$`)
+	unixTimeRegexp    = regexp.MustCompile(`^\d{9,13}$`)
+)
+
+// timeParser parses the value of a _time field according to the field's
+// layouts and timezone. now is the reference for relative times.
+type timeParser struct {
+	layouts []string
+	loc     *time.Location
+	now     func() time.Time
+}
+
+func newTimeParser(field *Field) (*timeParser, error) {
+	p := &timeParser{now: time.Now}
+	tz := DefaultTimezone
+	if field != nil {
+		if field.Layout != "" {
+			p.layouts = append(p.layouts, field.Layout)
+		}
+		p.layouts = append(p.layouts, field.Layouts...)
+		if field.Timezone != "" {
+			tz = field.Timezone
+		}
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %s: %v", tz, err)
+	}
+	p.loc = loc
+	return p, nil
+}
+
+// Parse understands the configured layouts, common absolute formats,
+// Unix timestamps in seconds or milliseconds and relative expressions such
+// as "3 hours ago", "yesterday 10:00" or "昨天".
+func (p *timeParser) Parse(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, fmt.Errorf("empty time value")
+	}
+
+	for _, layout := range p.layouts {
+		if t, err := time.ParseInLocation(layout, value, p.loc); err == nil {
+			return t, nil
+		}
+	}
+
+	if unixTimeRegexp.MatchString(value) {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err == nil {
+			if len(value) > 10 {
+				return time.UnixMilli(n).In(p.loc), nil
+			}
+			return time.Unix(n, 0).In(p.loc), nil
+		}
+	}
+
+	for _, layout := range defaultTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, p.loc); err == nil {
+			return t, nil
+		}
+	}
+
+	if t, ok := p.parseRelative(value); ok {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized time format: %s", value)
+}
+
+func (p *timeParser) parseRelative(value string) (time.Time, bool) {
+	now := p.now().In(p.loc)
+	lower := strings.ToLower(value)
+
+	switch lower {
+	case "just now", "now", "刚刚":
+		return now, true
+	}
+
+	if m := relativeAgoRegexp.FindStringSubmatch(lower); m != nil {
+		n := 1
+		if m[1] != "a" && m[1] != "an" {
+			n, _ = strconv.Atoi(m[1])
+		}
+		return subtractUnit(now, n, m[2]), true
+	}
+
+	if m := relativeCNRegexp.FindStringSubmatch(value); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		units := map[string]string{
+			"秒":  "second",
+			"分钟": "minute",
+			"小时": "hour",
+			"天":  "day",
+			"周":  "week",
+			"个月": "month",
+			"月":  "month",
+			"年":  "year",
+		}
+		return subtractUnit(now, n, units[m[2]]), true
+	}
+
+	if m := relativeDayRegexp.FindStringSubmatch(lower); m != nil {
+		days := map[string]int{"today": 0, "今天": 0, "yesterday": 1, "昨天": 1, "前天": 2}[m[1]]
+		day := time.Date(now.Year(), now.Month(), now.Day()-days, 0, 0, 0, 0, p.loc)
+		if m[2] != "" {
+			clock, err := time.Parse("15:04:05", m[2])
+			if err != nil {
+				if clock, err = time.Parse("15:04", m[2]); err != nil {
+					return time.Time{}, false
+				}
+			}
+			day = day.Add(time.Duration(clock.Hour())*time.Hour +
+				time.Duration(clock.Minute())*time.Minute +
+				time.Duration(clock.Second())*time.Second)
+		}
+		return day, true
+	}
+
+	return time.Time{}, false
+}
+
+func subtractUnit(now time.Time, n int, unit string) time.Time {
+	switch unit {
+	case "second", "sec":
+		return now.Add(-time.Duration(n) * time.Second)
+	case "minute", "min":
+		return now.Add(-time.Duration(n) * time.Minute)
+	case "hour", "hr":
+		return now.Add(-time.Duration(n) * time.Hour)
+	case "day":
+		return now.AddDate(0, 0, -n)
+	case "week":
+		return now.AddDate(0, 0, -7*n)
+	case "month":
+		return now.AddDate(0, -n, 0)
+	case "year":
+		return now.AddDate(-n, 0, 0)
+	}
+	return now
+}
+
+// schemaTimeField returns the top level _time field of schema, if any.
+func schemaTimeField(schema Schema) *Field {
+	for i := range schema.Fields {
+		if schema.Fields[i].Name == "_time" {
+			return &schema.Fields[i]
+		}
+	}
+	return nil
+}
+
+// extractExternalTime parses the _time value of item. The bool reports
+// whether a _time value was present; the error is set when it was present
+// but could not be parsed.
+func extractExternalTime(item map[string]interface{}, field *Field) (time.Time, bool, error) {
+	timeItem, ok := item["_time"]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	parser, err := newTimeParser(field)
+	if err != nil {
+		return time.Time{}, true, err
+	}
+
+	var value string
+	switch timeValue := timeItem.(type) {
+	case time.Time:
+		// Already parsed, by a datetime output_type.
+		return timeValue, true, nil
+	case string:
+		value = timeValue
+	case ExtractedItem:
+		type timeField struct {
+			FieldK string
+			FieldV string
+		}
+		timeFields := []timeField{}
+		for timek, timev := range timeValue {
+			if !strings.HasPrefix(timek, "_time") {
+				continue
+			}
+			if fieldV, ok := timev.(string); ok {
+				timeFields = append(timeFields, timeField{
+					FieldK: timek,
+					FieldV: fieldV,
+				})
+			}
+		}
+		sort.Slice(timeFields, func(i, j int) bool {
+			return timeFields[i].FieldK < timeFields[j].FieldK
+		})
+		timeParts := []string{}
+		for _, timeField := range timeFields {
+			timeParts = append(timeParts, timeField.FieldV)
+		}
+		value = strings.Join(timeParts, "/")
+	default:
+		return time.Time{}, true, fmt.Errorf("unsupported _time value of type %T", timeItem)
+	}
+
+	t, err := parser.Parse(value)
+	if err != nil {
+		return time.Time{}, true, err
+	}
+	return t, true, nil
+}
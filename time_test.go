@@ -0,0 +1,151 @@
+package extractor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeParserParse(t *testing.T) {
+	hk, err := time.LoadLocation(DefaultTimezone)
+	if err != nil {
+		t.Fatalf("failed to load %s: %v", DefaultTimezone, err)
+	}
+	// Friday 15 March 2024, 14:30:00 in Hong Kong.
+	now := time.Date(2024, 3, 15, 14, 30, 0, 0, hk)
+
+	tests := []struct {
+		name  string
+		field *Field
+		value string
+		want  time.Time
+	}{
+		{"configured layout", &Field{Layout: "02 Jan 2006 15:04"}, "05 Feb 2023 08:09", time.Date(2023, 2, 5, 8, 9, 0, 0, hk)},
+		{"configured layouts", &Field{Layouts: []string{"2006-01-02", "01/02/2006"}}, "07/04/2021", time.Date(2021, 7, 4, 0, 0, 0, 0, hk)},
+		{"layout before defaults", &Field{Layout: "2006/02/01"}, "2023/05/04", time.Date(2023, 4, 5, 0, 0, 0, 0, hk)},
+		{"field timezone", &Field{Timezone: "Europe/London"}, "2023-07-01 12:00", time.Date(2023, 7, 1, 11, 0, 0, 0, time.UTC)},
+		{"unix 9 digits", nil, "999999999", time.Unix(999999999, 0)},
+		{"unix 10 digits", nil, "1700000000", time.Unix(1700000000, 0)},
+		{"unix 11 digits as milliseconds", nil, "99999999999", time.UnixMilli(99999999999)},
+		{"unix 13 digits", nil, "1700000000123", time.UnixMilli(1700000000123)},
+		{"slashes", nil, "2023/01/02", time.Date(2023, 1, 2, 0, 0, 0, 0, hk)},
+		{"rfc3339", nil, "2023-01-02T03:04:05Z", time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"rfc3339 nano", nil, "2023-01-02T03:04:05.123+08:00", time.Date(2023, 1, 2, 3, 4, 5, 123000000, hk)},
+		{"iso local", nil, "2023-01-02T03:04:05", time.Date(2023, 1, 2, 3, 4, 5, 0, hk)},
+		{"date and minutes", nil, "2023-01-02 03:04", time.Date(2023, 1, 2, 3, 4, 0, 0, hk)},
+		{"short slashes", nil, "2023/1/2", time.Date(2023, 1, 2, 0, 0, 0, 0, hk)},
+		{"dots", nil, "2023.01.02", time.Date(2023, 1, 2, 0, 0, 0, 0, hk)},
+		{"compact", nil, "20230102", time.Date(2023, 1, 2, 0, 0, 0, 0, hk)},
+		{"chinese date", nil, "2023年1月2日 10:20", time.Date(2023, 1, 2, 10, 20, 0, 0, hk)},
+		{"rfc1123z", nil, "Mon, 02 Jan 2023 15:04:05 +0000", time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"month name", nil, "January 2, 2023", time.Date(2023, 1, 2, 0, 0, 0, 0, hk)},
+		{"day month name", nil, "2 Jan 2023", time.Date(2023, 1, 2, 0, 0, 0, 0, hk)},
+		{"surrounding space", nil, "  2023-01-02  ", time.Date(2023, 1, 2, 0, 0, 0, 0, hk)},
+		{"just now", nil, "just now", now},
+		{"seconds ago", nil, "30 seconds ago", now.Add(-30 * time.Second)},
+		{"minutes ago", nil, "5 mins ago", now.Add(-5 * time.Minute)},
+		{"an hour ago", nil, "an hour ago", now.Add(-time.Hour)},
+		{"days ago", nil, "3 days ago", time.Date(2024, 3, 12, 14, 30, 0, 0, hk)},
+		{"a week ago", nil, "a week ago", time.Date(2024, 3, 8, 14, 30, 0, 0, hk)},
+		{"months ago", nil, "2 months ago", time.Date(2024, 1, 15, 14, 30, 0, 0, hk)},
+		{"year ago", nil, "1 year ago", time.Date(2023, 3, 15, 14, 30, 0, 0, hk)},
+		{"capitalised", nil, "3 Hours Ago", now.Add(-3 * time.Hour)},
+		{"today", nil, "today", time.Date(2024, 3, 15, 0, 0, 0, 0, hk)},
+		{"yesterday with time", nil, "yesterday 10:05", time.Date(2024, 3, 14, 10, 5, 0, 0, hk)},
+		{"刚刚", nil, "刚刚", now},
+		{"秒前", nil, "45秒前", now.Add(-45 * time.Second)},
+		{"分钟前", nil, "5分钟前", now.Add(-5 * time.Minute)},
+		{"小时前", nil, "2小时前", now.Add(-2 * time.Hour)},
+		{"天前", nil, "3天前", time.Date(2024, 3, 12, 14, 30, 0, 0, hk)},
+		{"周前", nil, "1周前", time.Date(2024, 3, 8, 14, 30, 0, 0, hk)},
+		{"个月前", nil, "1个月前", time.Date(2024, 2, 15, 14, 30, 0, 0, hk)},
+		{"年前", nil, "2年前", time.Date(2022, 3, 15, 14, 30, 0, 0, hk)},
+		{"今天", nil, "今天 08:00", time.Date(2024, 3, 15, 8, 0, 0, 0, hk)},
+		{"昨天", nil, "昨天", time.Date(2024, 3, 14, 0, 0, 0, 0, hk)},
+		{"前天 with seconds", nil, "前天 23:59:58", time.Date(2024, 3, 13, 23, 59, 58, 0, hk)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newTimeParser(tt.field)
+			if err != nil {
+				t.Fatalf("newTimeParser failed: %v", err)
+			}
+			p.now = func() time.Time { return now }
+			got, err := p.Parse(tt.value)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.value, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("Parse(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeParserErrors(t *testing.T) {
+	p, err := newTimeParser(nil)
+	if err != nil {
+		t.Fatalf("newTimeParser failed: %v", err)
+	}
+	for _, value := range []string{"", "   ", "soon", "12345678", "12345678901234", "2023-13-45", "yesterday 25:00", "3 fortnights ago"} {
+		if got, err := p.Parse(value); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", value, got)
+		}
+	}
+	if _, err := newTimeParser(&Field{Timezone: "Mars/Olympus"}); err == nil {
+		t.Error("newTimeParser accepted an unknown timezone")
+	}
+}
+
+func TestExtractExternalTime(t *testing.T) {
+	parsed := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		item    map[string]interface{}
+		want    time.Time
+		present bool
+		wantErr bool
+	}{
+		{name: "missing", item: map[string]interface{}{}},
+		{name: "string", item: map[string]interface{}{"_time": "2023-01-02T03:04:05Z"}, want: parsed, present: true},
+		{name: "already a time", item: map[string]interface{}{"_time": parsed}, want: parsed, present: true},
+		{name: "parts joined in key order", item: map[string]interface{}{"_time": ExtractedItem{
+			"_time_2": "01", "_time_1": "2023", "_time_3": "02", "other": "x",
+		}}, want: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), present: true},
+		{name: "unparsable", item: map[string]interface{}{"_time": "soon"}, present: true, wantErr: true},
+		{name: "unsupported type", item: map[string]interface{}{"_time": 42}, present: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, present, err := extractExternalTime(tt.item, &Field{Name: "_time", Timezone: "UTC"})
+			if present != tt.present || (err != nil) != tt.wantErr {
+				t.Fatalf("extractExternalTime = %v, %v, %v; want present %v, error %v", got, present, err, tt.present, tt.wantErr)
+			}
+			if err == nil && !got.Equal(tt.want) {
+				t.Errorf("extractExternalTime = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDatetimeTimeField(t *testing.T) {
+	e := NewStaticExtractor(ExtractorConfig{Schemas: []Schema{{
+		Name:     "posts",
+		Selector: "//article",
+		Fields: []Field{
+			{Name: "title", Type: "text", Selector: ".//h2"},
+			{Name: "_time", Type: "text", From: FromElement, Pattern: `(.+)`, Selector: ".//time", OutputType: OutputDatetime, Timezone: "UTC"},
+		},
+	}}})
+	result, err := e.ExtractHTML([]byte(`<article><h2>A</h2><time>2023-01-02 03:04</time></article>`), "https://example.com/")
+	if err != nil {
+		t.Fatalf("ExtractHTML failed: %v", err)
+	}
+	items := result.SchemaResults["posts"].Items
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1; errors: %v", len(items), result.Errors)
+	}
+	want := time.Date(2023, 1, 2, 3, 4, 0, 0, time.UTC)
+	if got, ok := items[0]["external_time"].(time.Time); !ok || !got.Equal(want) || items[0]["external_time_extracted"] != true {
+		t.Errorf("external_time = %v (extracted %v), want %v; errors: %v", items[0]["external_time"], items[0]["external_time_extracted"], want, result.Errors)
+	}
+}
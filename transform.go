@@ -0,0 +1,293 @@
+package extractor
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+)
+
+// Transform types for Field.Transforms.
+const (
+	TransformTrim         string = "trim"
+	TransformRegexReplace string = "regex_replace"
+	TransformRegexExtract string = "regex_extract"
+	TransformSplit        string = "split"
+	TransformJoin         string = "join"
+	TransformLower        string = "lower"
+	TransformUpper        string = "upper"
+	TransformStripHTML    string = "strip_html"
+	TransformUnescape     string = "unescape"
+	TransformToInt        string = "to_int"
+	TransformToFloat      string = "to_float"
+	TransformToBool       string = "to_bool"
+	TransformDefault      string = "default"
+)
+
+// Transform is one step of the pipeline applied to an extracted value.
+// String transforms are applied to every element of a list value.
+type Transform struct {
+	Type string `json:"type"`
+	// Pattern is the regular expression of regex_replace and regex_extract.
+	Pattern string `json:"pattern,omitempty"`
+	// Replacement is used by regex_replace and may refer to groups as $1.
+	Replacement string `json:"replacement,omitempty"`
+	// Group selects the capture group returned by regex_extract. It
+	// defaults to 1 when the pattern has groups and to the whole match
+	// otherwise.
+	Group *int `json:"group,omitempty"`
+	// Separator is used by split and join and defaults to ",".
+	Separator string `json:"separator,omitempty"`
+	// Chars is the cutset of trim; surrounding whitespace is trimmed when
+	// it is empty.
+	Chars string `json:"chars,omitempty"`
+	// Value is the replacement for empty values used by default.
+	Value interface{} `json:"value,omitempty"`
+}
+
+func hasDefaultTransform(transforms []Transform) bool {
+	for _, t := range transforms {
+		if t.Type == TransformDefault {
+			return true
+		}
+	}
+	return false
+}
+
+// applyTransforms runs the pipeline over value in order.
+func (ev *evaluator) applyTransforms(value interface{}, transforms []Transform) (interface{}, error) {
+	for i, t := range transforms {
+		var err error
+		value, err = ev.applyTransform(value, t)
+		if err != nil {
+			return nil, fmt.Errorf("transforms[%d] %s: %v", i, t.Type, err)
+		}
+	}
+	return value, nil
+}
+
+func (ev *evaluator) applyTransform(value interface{}, t Transform) (interface{}, error) {
+	switch t.Type {
+	case TransformTrim:
+		return mapStrings(value, func(s string) (interface{}, error) {
+			if t.Chars == "" {
+				return strings.TrimSpace(s), nil
+			}
+			return strings.Trim(s, t.Chars), nil
+		})
+
+	case TransformRegexReplace:
+		re, err := ev.config.regexp(t.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return mapStrings(value, func(s string) (interface{}, error) {
+			return re.ReplaceAllString(s, t.Replacement), nil
+		})
+
+	case TransformRegexExtract:
+		re, err := ev.config.regexp(t.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		group := 0
+		if t.Group != nil {
+			group = *t.Group
+		} else if re.NumSubexp() > 0 {
+			group = 1
+		}
+		if group > re.NumSubexp() {
+			return nil, fmt.Errorf("pattern %s has no group %d", t.Pattern, group)
+		}
+		return mapStrings(value, func(s string) (interface{}, error) {
+			matches := re.FindStringSubmatch(s)
+			if matches == nil {
+				return nil, fmt.Errorf("pattern %s does not match %q", t.Pattern, s)
+			}
+			return matches[group], nil
+		})
+
+	case TransformSplit:
+		switch v := value.(type) {
+		case nil:
+			return nil, nil
+		case string:
+			return strings.Split(v, separator(t)), nil
+		default:
+			return nil, fmt.Errorf("expects a string, got %T", value)
+		}
+
+	case TransformJoin:
+		var parts []string
+		switch v := value.(type) {
+		case nil:
+			return nil, nil
+		case []string:
+			parts = v
+		case []interface{}:
+			for _, elem := range v {
+				parts = append(parts, fmt.Sprint(elem))
+			}
+		case string:
+			return v, nil
+		default:
+			return nil, fmt.Errorf("expects a list, got %T", value)
+		}
+		return strings.Join(parts, separator(t)), nil
+
+	case TransformLower:
+		return mapStrings(value, func(s string) (interface{}, error) {
+			return strings.ToLower(s), nil
+		})
+
+	case TransformUpper:
+		return mapStrings(value, func(s string) (interface{}, error) {
+			return strings.ToUpper(s), nil
+		})
+
+	case TransformStripHTML:
+		return mapStrings(value, func(s string) (interface{}, error) {
+			return stripHTML(s), nil
+		})
+
+	case TransformUnescape:
+		return mapStrings(value, func(s string) (interface{}, error) {
+			return html.UnescapeString(s), nil
+		})
+
+	case TransformToInt:
+		return mapStrings(value, func(s string) (interface{}, error) {
+			return parseInt(s)
+		})
+
+	case TransformToFloat:
+		return mapStrings(value, func(s string) (interface{}, error) {
+			return parseFloat(s)
+		})
+
+	case TransformToBool:
+		return mapStrings(value, func(s string) (interface{}, error) {
+			return parseBool(s)
+		})
+
+	case TransformDefault:
+		if isEmptyValue(value) {
+			return t.Value, nil
+		}
+		return value, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported transform")
+	}
+}
+
+func separator(t Transform) string {
+	if t.Separator == "" {
+		return ","
+	}
+	return t.Separator
+}
+
+// mapStrings applies fn to a string value or to every string of a list
+// value. nil is passed through so that a later default step can fill it.
+func mapStrings(value interface{}, fn func(string) (interface{}, error)) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return fn(v)
+	case []string:
+		result := make([]interface{}, len(v))
+		for i, s := range v {
+			out, err := fn(s)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = out
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, elem := range v {
+			out, err := mapStrings(elem, fn)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = out
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("expects a string or a list of strings, got %T", value)
+	}
+}
+
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	case []string:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	case []map[string]interface{}:
+		return len(v) == 0
+	case ExtractedItem:
+		return len(v) == 0
+	}
+	return false
+}
+
+// stripHTML returns the text content of an HTML fragment.
+func stripHTML(s string) string {
+	var sb strings.Builder
+	tokenizer := nethtml.NewTokenizer(strings.NewReader(s))
+	for {
+		switch tokenizer.Next() {
+		case nethtml.ErrorToken:
+			return strings.TrimSpace(sb.String())
+		case nethtml.TextToken:
+			sb.Write(tokenizer.Text())
+		}
+	}
+}
+
+// cleanNumber drops whitespace, thousands separators and underscores.
+func cleanNumber(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ',', '_', ' ', '\t', '\n', '\u00a0':
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func parseInt(s string) (int64, error) {
+	n, err := strconv.ParseInt(cleanNumber(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer %q", s)
+	}
+	return n, nil
+}
+
+func parseFloat(s string) (float64, error) {
+	f, err := strconv.ParseFloat(cleanNumber(s), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return f, nil
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "t", "true", "y", "yes", "on":
+		return true, nil
+	case "0", "f", "false", "n", "no", "off", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", s)
+}
@@ -0,0 +1,111 @@
+package extractor
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestApplyTransforms(t *testing.T) {
+	one := 1
+	tests := []struct {
+		name       string
+		value      interface{}
+		transforms []Transform
+		want       string
+	}{
+		{"trim", "  a  ", []Transform{{Type: TransformTrim}}, `"a"`},
+		{"trim chars", "--a--", []Transform{{Type: TransformTrim, Chars: "-"}}, `"a"`},
+		{"regex replace", "a1b22", []Transform{{Type: TransformRegexReplace, Pattern: `\d+`, Replacement: "#"}}, `"a#b#"`},
+		{"regex extract group", "price: 12 EUR", []Transform{{Type: TransformRegexExtract, Pattern: `(\d+) (\w+)`, Group: &one}}, `"12"`},
+		{"regex extract whole match", "price: 12", []Transform{{Type: TransformRegexExtract, Pattern: `\d+`}}, `"12"`},
+		{"split", "a,b,c", []Transform{{Type: TransformSplit}}, `["a","b","c"]`},
+		{"split and trim each", "a | b", []Transform{{Type: TransformSplit, Separator: "|"}, {Type: TransformTrim}}, `["a","b"]`},
+		{"join", []interface{}{"a", 1}, []Transform{{Type: TransformJoin, Separator: "; "}}, `"a; 1"`},
+		{"join a string", "a", []Transform{{Type: TransformJoin}}, `"a"`},
+		{"lower and upper", []string{"Ab"}, []Transform{{Type: TransformLower}, {Type: TransformUpper}}, `["AB"]`},
+		{"strip html and unescape", "<b>a &amp;amp; b</b>", []Transform{{Type: TransformStripHTML}, {Type: TransformUnescape}}, `"a \u0026 b"`},
+		{"to int", "1,234", []Transform{{Type: TransformToInt}}, `1234`},
+		{"to float", "12.5", []Transform{{Type: TransformToFloat}}, `12.5`},
+		{"to bool", "yes", []Transform{{Type: TransformToBool}}, `true`},
+		{"default on empty", "", []Transform{{Type: TransformDefault, Value: "none"}}, `"none"`},
+		{"default keeps value", "a", []Transform{{Type: TransformDefault, Value: "none"}}, `"a"`},
+		{"missing through split", nil, []Transform{{Type: TransformSplit}, {Type: TransformDefault, Value: []interface{}{}}}, `[]`},
+		{"missing through join", nil, []Transform{{Type: TransformJoin}, {Type: TransformDefault, Value: "none"}}, `"none"`},
+		{"missing through every step", nil, []Transform{
+			{Type: TransformTrim}, {Type: TransformSplit}, {Type: TransformJoin}, {Type: TransformToInt}, {Type: TransformDefault, Value: 0},
+		}, `0`},
+		{"missing without default", nil, []Transform{{Type: TransformSplit}}, `null`},
+	}
+	ev := &evaluator{config: &CompiledConfig{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := ev.applyTransforms(tt.value, tt.transforms)
+			if err != nil {
+				t.Fatalf("applyTransforms failed: %v", err)
+			}
+			got, err := json.Marshal(value)
+			if err != nil {
+				t.Fatalf("failed to encode result: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("applyTransforms(%#v) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTransformsErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     interface{}
+		transform Transform
+	}{
+		{"split a list", []string{"a"}, Transform{Type: TransformSplit}},
+		{"join a number", 1, Transform{Type: TransformJoin}},
+		{"regex extract without match", "abc", Transform{Type: TransformRegexExtract, Pattern: `\d+`}},
+		{"to int", "abc", Transform{Type: TransformToInt}},
+		{"unknown", "abc", Transform{Type: "reverse"}},
+	}
+	ev := &evaluator{config: &CompiledConfig{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if value, err := ev.applyTransforms(tt.value, []Transform{tt.transform}); err == nil {
+				t.Errorf("applyTransforms(%#v) = %#v, want an error", tt.value, value)
+			}
+		})
+	}
+}
+
+func TestTransformsOnMissingField(t *testing.T) {
+	e := NewStaticExtractor(ExtractorConfig{Schemas: []Schema{{
+		Name:     "posts",
+		Selector: "//article",
+		Fields: []Field{
+			{Name: "title", Type: "text", Selector: ".//h2"},
+			{Name: "tags", Type: "text", Selector: ".//*[@class='tags']", Transforms: []Transform{
+				{Type: TransformSplit}, {Type: TransformTrim}, {Type: TransformDefault, Value: []interface{}{}},
+			}},
+		},
+	}}})
+	result, err := e.ExtractHTML([]byte(`<article><h2>A</h2><p class="tags">go, web</p></article><article><h2>B</h2></article>`), "https://example.com/")
+	if err != nil {
+		t.Fatalf("ExtractHTML failed: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Errorf("unexpected errors: %v", result.Errors)
+	}
+	items := result.SchemaResults["posts"].Items
+	want := []string{`["go","web"]`, `[]`}
+	if len(items) != len(want) {
+		t.Fatalf("got %d items, want %d: %v", len(items), len(want), items)
+	}
+	for i := range want {
+		got, err := json.Marshal(items[i]["tags"])
+		if err != nil {
+			t.Fatalf("failed to encode tags: %v", err)
+		}
+		if string(got) != want[i] {
+			t.Errorf("item %d: tags = %s, want %s", i, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package extractor
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// defaultNamespaces are the prefixes XPath selectors may use in xml mode
+// without declaring them in ExtractorConfig.Namespaces.
+var defaultNamespaces = map[string]string{
+	"atom":    "http://www.w3.org/2005/Atom",
+	"content": "http://purl.org/rss/1.0/modules/content/",
+	"dc":      "http://purl.org/dc/elements/1.1/",
+	"itunes":  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+	"media":   "http://search.yahoo.com/mrss/",
+	"rdf":     "http://www.w3.org/1999/02/22-rdf-syntax-ns#",
+	"rss":     "http://purl.org/rss/1.0/",
+	"xml":     "http://www.w3.org/XML/1998/namespace",
+}
+
+// xmlTreeNode is a node of a parsed XML document. Unlike the HTML parser it
+// keeps the prefix and the namespace of every element and attribute.
+type xmlTreeNode struct {
+	Type xpath.NodeType
+	// Prefix and Local make up the name of elements and attributes as
+	// written in the document; Space is the namespace the prefix resolves
+	// to.
+	Prefix, Local, Space string
+	// Data is the content of text and comment nodes and the value of
+	// attribute nodes.
+	Data string
+	Attr []xmlAttr
+
+	Parent, FirstChild, LastChild, PrevSibling, NextSibling *xmlTreeNode
+}
+
+type xmlAttr struct {
+	Prefix, Local, Space string
+	Value                string
+}
+
+func (a xmlAttr) name() string {
+	return qualifiedName(a.Prefix, a.Local)
+}
+
+func (n *xmlTreeNode) name() string {
+	return qualifiedName(n.Prefix, n.Local)
+}
+
+func qualifiedName(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+func (n *xmlTreeNode) appendChild(c *xmlTreeNode) {
+	c.Parent = n
+	if n.LastChild == nil {
+		n.FirstChild = c
+	} else {
+		n.LastChild.NextSibling = c
+		c.PrevSibling = n.LastChild
+	}
+	n.LastChild = c
+}
+
+// text returns the concatenated text below n, or the value of an attribute
+// node.
+func (n *xmlTreeNode) text() string {
+	switch n.Type {
+	case xpath.TextNode, xpath.AttributeNode:
+		return n.Data
+	case xpath.CommentNode:
+		return ""
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(c.text())
+	}
+	return sb.String()
+}
+
+// parseXML parses an XML document leniently: HTML entities are understood,
+// unknown end tags are ignored and unclosed elements are closed at the end
+// of the document. Encodings other than UTF-8 are converted.
+func parseXML(r io.Reader) (*xmlTreeNode, error) {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	d.CharsetReader = charset.NewReaderLabel
+
+	doc := &xmlTreeNode{Type: xpath.RootNode}
+	current := doc
+	// scopes holds the namespace declarations of the open elements.
+	scopes := []map[string]string{{"xml": defaultNamespaces["xml"]}}
+	lookup := func(prefix string) string {
+		for i := len(scopes) - 1; i >= 0; i-- {
+			if uri, ok := scopes[i][prefix]; ok {
+				return uri
+			}
+		}
+		return ""
+	}
+
+	for {
+		token, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse XML: %v", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			scope := make(map[string]string)
+			for _, attr := range t.Attr {
+				switch {
+				case attr.Name.Space == "xmlns":
+					scope[attr.Name.Local] = attr.Value
+				case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+					scope[""] = attr.Value
+				}
+			}
+			scopes = append(scopes, scope)
+			n := &xmlTreeNode{
+				Type:   xpath.ElementNode,
+				Prefix: t.Name.Space,
+				Local:  t.Name.Local,
+				Space:  lookup(t.Name.Space),
+			}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+					continue
+				}
+				a := xmlAttr{Prefix: attr.Name.Space, Local: attr.Name.Local, Value: attr.Value}
+				if a.Prefix != "" {
+					a.Space = lookup(a.Prefix)
+				}
+				n.Attr = append(n.Attr, a)
+			}
+			current.appendChild(n)
+			current = n
+
+		case xml.EndElement:
+			// Close the innermost open element of that name, which also
+			// closes the elements left open inside it.
+			depth := 0
+			for n := current; n != doc; n = n.Parent {
+				depth++
+				if n.Prefix == t.Name.Space && n.Local == t.Name.Local {
+					current = n.Parent
+					scopes = scopes[:len(scopes)-depth]
+					break
+				}
+			}
+
+		case xml.CharData:
+			if last := current.LastChild; last != nil && last.Type == xpath.TextNode {
+				last.Data += string(t)
+			} else {
+				current.appendChild(&xmlTreeNode{Type: xpath.TextNode, Data: string(t)})
+			}
+
+		case xml.Comment:
+			current.appendChild(&xmlTreeNode{Type: xpath.CommentNode, Data: string(t)})
+		}
+	}
+	if doc.FirstChild == nil {
+		return nil, fmt.Errorf("failed to parse XML: no elements found")
+	}
+	return doc, nil
+}
+
+// xmlNavigator implements xpath.NodeNavigator over xmlTreeNode. attr is the
+// index of the current attribute, or -1 when on the node itself.
+type xmlNavigator struct {
+	root, curr *xmlTreeNode
+	attr       int
+}
+
+func newXMLNavigator(n *xmlTreeNode) *xmlNavigator {
+	root := n
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	return &xmlNavigator{root: root, curr: n, attr: -1}
+}
+
+func (x *xmlNavigator) NodeType() xpath.NodeType {
+	if x.attr != -1 {
+		return xpath.AttributeNode
+	}
+	return x.curr.Type
+}
+
+func (x *xmlNavigator) LocalName() string {
+	if x.attr != -1 {
+		return x.curr.Attr[x.attr].Local
+	}
+	return x.curr.Local
+}
+
+func (x *xmlNavigator) Prefix() string {
+	if x.attr != -1 {
+		return x.curr.Attr[x.attr].Prefix
+	}
+	return x.curr.Prefix
+}
+
+// NamespaceURL lets prefixed name tests match by namespace, so a selector
+// can use its own prefixes for the namespaces of the document.
+func (x *xmlNavigator) NamespaceURL() string {
+	if x.attr != -1 {
+		return x.curr.Attr[x.attr].Space
+	}
+	return x.curr.Space
+}
+
+func (x *xmlNavigator) Value() string {
+	if x.attr != -1 {
+		return x.curr.Attr[x.attr].Value
+	}
+	if x.curr.Type == xpath.CommentNode {
+		return x.curr.Data
+	}
+	return x.curr.text()
+}
+
+func (x *xmlNavigator) Copy() xpath.NodeNavigator {
+	n := *x
+	return &n
+}
+
+func (x *xmlNavigator) MoveToRoot() {
+	x.curr = x.root
+	x.attr = -1
+}
+
+func (x *xmlNavigator) MoveToParent() bool {
+	if x.attr != -1 {
+		x.attr = -1
+		return true
+	}
+	if x.curr.Parent != nil {
+		x.curr = x.curr.Parent
+		return true
+	}
+	return false
+}
+
+func (x *xmlNavigator) MoveToNextAttribute() bool {
+	if x.attr >= len(x.curr.Attr)-1 {
+		return false
+	}
+	x.attr++
+	return true
+}
+
+func (x *xmlNavigator) MoveToChild() bool {
+	if x.attr != -1 || x.curr.FirstChild == nil {
+		return false
+	}
+	x.curr = x.curr.FirstChild
+	return true
+}
+
+func (x *xmlNavigator) MoveToFirst() bool {
+	if x.attr != -1 || x.curr.PrevSibling == nil {
+		return false
+	}
+	for x.curr.PrevSibling != nil {
+		x.curr = x.curr.PrevSibling
+	}
+	return true
+}
+
+func (x *xmlNavigator) MoveToNext() bool {
+	if x.attr != -1 || x.curr.NextSibling == nil {
+		return false
+	}
+	x.curr = x.curr.NextSibling
+	return true
+}
+
+func (x *xmlNavigator) MoveToPrevious() bool {
+	if x.attr != -1 || x.curr.PrevSibling == nil {
+		return false
+	}
+	x.curr = x.curr.PrevSibling
+	return true
+}
+
+func (x *xmlNavigator) MoveTo(other xpath.NodeNavigator) bool {
+	o, ok := other.(*xmlNavigator)
+	if !ok || o.root != x.root {
+		return false
+	}
+	x.curr = o.curr
+	x.attr = o.attr
+	return true
+}
+
+func (x *xmlNavigator) String() string {
+	return x.Value()
+}
+
+// current returns the node the navigator is on. Attributes are returned as
+// detached attribute nodes whose parent is their element.
+func (x *xmlNavigator) current() *xmlTreeNode {
+	if x.attr == -1 {
+		return x.curr
+	}
+	a := x.curr.Attr[x.attr]
+	return &xmlTreeNode{
+		Type:   xpath.AttributeNode,
+		Prefix: a.Prefix,
+		Local:  a.Local,
+		Space:  a.Space,
+		Data:   a.Value,
+		Parent: x.curr,
+	}
+}
+
+// xmlToHTML converts n to an HTML tree so that the markup field types work
+// on XML. Text that contains markup, such as the escaped or CDATA content
+// of RSS descriptions, is parsed as HTML.
+func xmlToHTML(n *xmlTreeNode) *html.Node {
+	switch n.Type {
+	case xpath.TextNode, xpath.AttributeNode:
+		return &html.Node{Type: html.TextNode, Data: n.Data}
+	case xpath.CommentNode:
+		return &html.Node{Type: html.CommentNode, Data: n.Data}
+	}
+
+	var out *html.Node
+	if n.Type == xpath.RootNode {
+		out = &html.Node{Type: html.DocumentNode}
+	} else {
+		out = &html.Node{Type: html.ElementNode, Data: n.name(), DataAtom: atom.Lookup([]byte(n.name()))}
+		for _, a := range n.Attr {
+			out.Attr = append(out.Attr, html.Attribute{Key: a.name(), Val: a.Value})
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != xpath.TextNode || !strings.Contains(c.Data, "<") {
+			out.AppendChild(xmlToHTML(c))
+			continue
+		}
+		context := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+		nodes, err := html.ParseFragment(strings.NewReader(c.Data), context)
+		if err != nil {
+			out.AppendChild(xmlToHTML(c))
+			continue
+		}
+		for _, fragment := range nodes {
+			out.AppendChild(fragment)
+		}
+	}
+	return out
+}
@@ -0,0 +1,110 @@
+package extractor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// XMLExtractor extracts items from XML documents such as RSS and Atom
+// feeds. Selectors are XPath expressions that may use namespace prefixes.
+type XMLExtractor struct {
+	Config ExtractorConfig
+
+	compiled   *CompiledConfig
+	compileErr error
+}
+
+func NewXMLExtractor(config ExtractorConfig) *XMLExtractor {
+	if config.Mode == "" {
+		config.Mode = ModeXML
+	}
+	compiled, err := CompileConfig(config)
+	return &XMLExtractor{Config: config, compiled: compiled, compileErr: err}
+}
+
+func (e *XMLExtractor) ExtractWithoutCache(url string) (*ExtractionResult, error) {
+	return e.extract(context.Background(), url, false)
+}
+
+func (e *XMLExtractor) Extract(url string) (*ExtractionResult, error) {
+	return e.extract(context.Background(), url, true)
+}
+
+func (e *XMLExtractor) ExtractWithoutCacheContext(ctx context.Context, url string) (*ExtractionResult, error) {
+	return e.extract(ctx, url, false)
+}
+
+func (e *XMLExtractor) ExtractContext(ctx context.Context, url string) (*ExtractionResult, error) {
+	return e.extract(ctx, url, true)
+}
+
+func (e *XMLExtractor) extract(ctx context.Context, url string, cache bool) (*ExtractionResult, error) {
+	if e.compileErr != nil {
+		return nil, e.compileErr
+	}
+	client, err := getPageCache()
+	if err != nil {
+		return nil, err
+	}
+	content, finalURL, err := client.fetch(ctx, url, cache)
+	if err != nil {
+		if _, ok := err.(*TimeoutError); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+
+	doc, err := parseXML(bytes.NewReader(content))
+	if err != nil {
+		client.forget(url)
+		return nil, err
+	}
+
+	result, err := e.extractDocument(ctx, doc, url, finalURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Do not keep broken documents in the cache.
+	if result.Status == StatusFailed {
+		client.forget(url)
+	}
+
+	return result, nil
+}
+
+// ExtractXML runs the config against an already fetched document. baseURL
+// is the logical URL of the document and is what the _id and _time URL
+// patterns see.
+func (e *XMLExtractor) ExtractXML(content []byte, baseURL string) (*ExtractionResult, error) {
+	return e.ExtractReader(bytes.NewReader(content), baseURL)
+}
+
+// ExtractReader is like ExtractXML but reads the document from r.
+func (e *XMLExtractor) ExtractReader(r io.Reader, baseURL string) (*ExtractionResult, error) {
+	if e.compileErr != nil {
+		return nil, e.compileErr
+	}
+	doc, err := parseXML(r)
+	if err != nil {
+		return nil, err
+	}
+	return e.extractDocument(context.Background(), doc, baseURL, baseURL)
+}
+
+// extractDocument applies every schema to doc.
+func (e *XMLExtractor) extractDocument(ctx context.Context, doc *xmlTreeNode, url, finalURL string) (*ExtractionResult, error) {
+	result := &ExtractionResult{
+		SchemaResults: make(map[string]SchemaResult),
+		Errors:        make([]ExtractionError, 0),
+		FinalURL:      finalURL,
+		Mode:          ModeXML,
+	}
+
+	if err := extractSchemas(ctx, e.compiled, newXMLNode(doc, finalURL, e.compiled), url, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,85 @@
+package extractor
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/antchfx/xpath"
+)
+
+const xmlFixture = `<?xml version="1.0" encoding="utf-8"?>
+<catalog xmlns="urn:example:catalog" xmlns:m="http://search.yahoo.com/mrss/" xmlns:x="http://www.w3.org/1999/xlink">
+  <!-- generated -->
+  <product id="p1" xml:lang="en">
+    <name>Caf&eacute; table</name>
+    <price currency="EUR">120</price>
+    <m:content url="https://cdn.example.com/p1.jpg" x:href="/p1"/>
+  </product>
+  <product id="p2">
+    <name>Chair</name>
+    <price currency="USD">45</price>
+    <tags><tag>wood</tag><tag>oak</tag></tags>
+  </product>
+  <other:product xmlns:other="urn:example:other" id="p3"><name>Foreign</name></other:product>
+  <note>unclosed <b>bold
+</catalog>`
+
+func TestXMLNavigator(t *testing.T) {
+	doc, err := parseXML(strings.NewReader(xmlFixture))
+	if err != nil {
+		t.Fatalf("parseXML failed: %v", err)
+	}
+	namespaces := map[string]string{
+		"c":     "urn:example:catalog",
+		"media": "http://search.yahoo.com/mrss/",
+		"xlink": "http://www.w3.org/1999/xlink",
+		"xml":   defaultNamespaces["xml"],
+	}
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"//c:product/@id", "p1|p2"},
+		{"//product/@id", "p1|p2"},
+		{"//*[local-name()='product']/@id", "p1|p2|p3"},
+		{"//c:product[@xml:lang='en']/c:name", "Café table"},
+		{"//c:price[@currency='USD']", "45"},
+		{"//media:content/@url", "https://cdn.example.com/p1.jpg"},
+		{"//media:content/@xlink:href", "/p1"},
+		{"namespace-uri(//*[local-name()='product'][3])", "urn:example:other"},
+		{"name(//*[@id='p3'])", "other:product"},
+		{"local-name(//media:content)", "content"},
+		{"//c:tag[last()]", "oak"},
+		{"//c:tag[1]/following-sibling::c:tag", "oak"},
+		{"//@currency[.='EUR']/../../@id", "p1"},
+		{"//c:product[c:tags]/c:name", "Chair"},
+		{"count(//c:product)", "2"},
+		{"normalize-space(//c:note)", "unclosed bold"},
+		{"//comment()", " generated "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := xpath.CompileWithNS(tt.expr, namespaces)
+			if err != nil {
+				t.Fatalf("failed to compile %q: %v", tt.expr, err)
+			}
+			var got string
+			switch value := expr.Evaluate(newXMLNavigator(doc)).(type) {
+			case *xpath.NodeIterator:
+				var values []string
+				for value.MoveNext() {
+					values = append(values, value.Current().Value())
+				}
+				got = strings.Join(values, "|")
+			case float64:
+				got = strconv.FormatFloat(value, 'f', -1, 64)
+			case string:
+				got = value
+			}
+			if got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.expr, got, tt.want)
+			}
+		})
+	}
+}